@@ -44,7 +44,6 @@ import (
 	"knative.dev/pkg/injection/sharedmain"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/signals"
-	"knative.dev/pkg/system"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 )
 
@@ -73,29 +72,41 @@ func main() {
 	ctx := LoggingContextOrDie(config, clientSet)
 	ctx = injection.WithConfig(ctx, config)
 	ctx = injection.WithOptions(ctx, opts)
+	for _, warning := range opts.Warnings() {
+		logging.FromContext(ctx).Warn(warning)
+	}
 
 	// Set up controller runtime controller
 	cloudProvider := registry.NewCloudProvider(ctx, cloudprovider.Options{ClientSet: clientSet})
 	cloudProvider = cloudprovidermetrics.Decorate(cloudProvider)
 	manager := controllers.NewManagerOrDie(ctx, config, controllerruntime.Options{
-		Logger:                 zapr.NewLogger(logging.FromContext(ctx).Desugar()),
-		LeaderElection:         true,
-		LeaderElectionID:       "karpenter-leader-election",
-		Scheme:                 scheme,
-		MetricsBindAddress:     fmt.Sprintf(":%d", opts.MetricsPort),
-		HealthProbeBindAddress: fmt.Sprintf(":%d", opts.HealthProbePort),
+		Logger:                  zapr.NewLogger(logging.FromContext(ctx).Desugar()),
+		LeaderElection:          true,
+		LeaderElectionID:        "karpenter-leader-election",
+		LeaderElectionNamespace: opts.Namespace,
+		Scheme:                  scheme,
+		MetricsBindAddress:      "0", // Metrics are served by the manager with timeouts
+		HealthProbeBindAddress:  fmt.Sprintf(":%d", opts.HealthProbePort),
+		SyncPeriod:              opts.SyncPeriod(),
 	})
 
-	provisioningController := provisioning.NewController(ctx, manager.GetClient(), clientSet.CoreV1(), cloudProvider)
-
-	if err := manager.RegisterControllers(ctx,
-		provisioningController,
-		selection.NewController(manager.GetClient(), provisioningController),
+	// In read-only mode, only the controllers that observe the cluster are
+	// registered. The node controller skips its mutations, and the termination
+	// controller only removes finalizers so that deleted nodes are not blocked.
+	registered := []controllers.Controller{
 		termination.NewController(ctx, manager.GetClient(), clientSet.CoreV1(), cloudProvider),
 		node.NewController(manager.GetClient()),
 		metrics.NewController(manager.GetClient(), cloudProvider),
-		counter.NewController(manager.GetClient()),
-	).Start(ctx); err != nil {
+	}
+	if !opts.ReadOnly {
+		provisioningController := provisioning.NewController(ctx, manager.GetClient(), clientSet.CoreV1(), cloudProvider)
+		registered = append(registered,
+			provisioningController,
+			selection.NewController(manager.GetClient(), provisioningController),
+			counter.NewController(manager.GetClient()),
+		)
+	}
+	if err := manager.RegisterControllers(ctx, registered...).Start(ctx); err != nil {
 		panic(fmt.Sprintf("Unable to start manager, %s", err.Error()))
 	}
 }
@@ -107,7 +118,7 @@ func LoggingContextOrDie(config *rest.Config, clientSet *kubernetes.Clientset) c
 	logger, atomicLevel := sharedmain.SetupLoggerOrDie(ctx, component)
 	ctx = logging.WithLogger(ctx, logger)
 	rest.SetDefaultWarningHandler(&logging.WarningHandler{Logger: logger})
-	cmw := informer.NewInformedWatcher(clientSet, system.Namespace())
+	cmw := informer.NewInformedWatcher(clientSet, opts.Namespace)
 	sharedmain.WatchLoggingConfigOrDie(ctx, cmw, logger, atomicLevel, component)
 	if err := cmw.Start(ctx.Done()); err != nil {
 		logger.Fatalf("Failed to watch logging configuration, %s", err.Error())
@@ -16,10 +16,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/aws/karpenter/pkg/apis"
 	"github.com/aws/karpenter/pkg/cloudprovider"
 	"github.com/aws/karpenter/pkg/cloudprovider/registry"
+	"github.com/aws/karpenter/pkg/metrics"
 	"github.com/aws/karpenter/pkg/utils/injection"
 	"github.com/aws/karpenter/pkg/utils/options"
 	"k8s.io/client-go/kubernetes"
@@ -29,7 +31,6 @@ import (
 	"knative.dev/pkg/injection/sharedmain"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/signals"
-	"knative.dev/pkg/system"
 	"knative.dev/pkg/webhook"
 	"knative.dev/pkg/webhook/certificates"
 	"knative.dev/pkg/webhook/configmaps"
@@ -43,12 +44,21 @@ var (
 
 func main() {
 	config := knativeinjection.ParseAndGetRESTConfigOrDie()
-	ctx := webhook.WithOptions(knativeinjection.WithNamespaceScope(signals.NewContext(), system.Namespace()), webhook.Options{
-		Port:        opts.WebhookPort,
-		ServiceName: "karpenter-webhook",
-		SecretName:  "karpenter-webhook-cert",
+	statsReporter, err := webhook.NewStatsReporter()
+	if err != nil {
+		panic(fmt.Sprintf("Unable to create webhook stats reporter, %s", err.Error()))
+	}
+	ctx := webhook.WithOptions(knativeinjection.WithNamespaceScope(signals.NewContext(), opts.Namespace), webhook.Options{
+		Port:          opts.WebhookPort,
+		ServiceName:   "karpenter-webhook",
+		SecretName:    "karpenter-webhook-cert",
+		StatsReporter: metrics.DecorateWebhookStatsReporter(statsReporter),
 	})
 
+	// Serve the webhook request metrics recorded in the controller-runtime
+	// registry, with the same paths and extra labels as the controller
+	go serveMetrics(ctx)
+
 	// Register the cloud provider to attach vendor specific validation logic.
 	registry.NewCloudProvider(ctx, cloudprovider.Options{ClientSet: kubernetes.NewForConfigOrDie(config)})
 
@@ -91,6 +101,13 @@ func newConfigValidationController(ctx context.Context, cmw configmap.Watcher) *
 	)
 }
 
+// serveMetrics serves metrics until the context is done
+func serveMetrics(ctx context.Context) {
+	if err := metrics.NewServerFromOptions(opts).Start(ctx); err != nil {
+		logging.FromContext(ctx).Errorf("Serving metrics, %s", err.Error())
+	}
+}
+
 func InjectContext(ctx context.Context) context.Context {
 	return injection.WithOptions(ctx, opts)
 }
@@ -32,9 +32,12 @@ var (
 	OperatingSystemLinux = "linux"
 
 	ProvisionerNameLabelKey         = SchemeGroupVersion.Group + "/provisioner-name"
+	ProvisionerGenerationLabelKey   = SchemeGroupVersion.Group + "/provisioner-generation"
 	NotReadyTaintKey                = SchemeGroupVersion.Group + "/not-ready"
 	DoNotEvictPodAnnotationKey      = SchemeGroupVersion.Group + "/do-not-evict"
 	EmptinessTimestampAnnotationKey = SchemeGroupVersion.Group + "/emptiness-timestamp"
+	MetricsExcludeAnnotationKey     = SchemeGroupVersion.Group + "/metrics-exclude"
+	BootstrapStageAnnotationKey     = SchemeGroupVersion.Group + "/bootstrap-stage"
 	TerminationFinalizer            = SchemeGroupVersion.Group + "/termination"
 	DefaultProvisioner              = types.NamespacedName{Name: "default"}
 )
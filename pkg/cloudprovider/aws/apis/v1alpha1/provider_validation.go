@@ -16,22 +16,56 @@ package v1alpha1
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 	"knative.dev/pkg/apis"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// launchTemplateNameRegex matches the launch template names allowed by EC2
+var launchTemplateNameRegex = regexp.MustCompile(`^[a-zA-Z0-9().\-/_]{3,128}$`)
+
+var validationErrorsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "provider",
+		Name:      "validation_errors_total",
+		Help:      "Count of AWS provider validation errors by field.",
+	},
+	[]string{"field"},
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(validationErrorsCounter)
+}
+
 func (a *AWS) Validate() (errs *apis.FieldError) {
 	return a.validate().ViaField("provider")
 }
 
 func (a *AWS) validate() (errs *apis.FieldError) {
-	return errs.Also(
-		a.validateInstanceProfile(),
-		a.validateLaunchTemplate(),
-		a.validateSubnets(),
-		a.validateSecurityGroups(),
-		a.validateTags(),
-	)
+	for _, validator := range []struct {
+		field    string
+		validate func() *apis.FieldError
+	}{
+		{"instanceProfile", a.validateInstanceProfile},
+		{"launchTemplate", a.validateLaunchTemplate},
+		{"subnetSelector", a.validateSubnets},
+		{"securityGroupSelector", a.validateSecurityGroups},
+		{"selectors", a.validateSelectorsTogether},
+		{"tags", a.validateTags},
+	} {
+		if err := validator.validate(); err != nil {
+			validationErrorsCounter.WithLabelValues(validator.field).Inc()
+			errs = errs.Also(err)
+		}
+	}
+	return errs
 }
 
 func (a *AWS) validateInstanceProfile() (errs *apis.FieldError) {
@@ -42,7 +76,13 @@ func (a *AWS) validateInstanceProfile() (errs *apis.FieldError) {
 }
 
 func (a *AWS) validateLaunchTemplate() (errs *apis.FieldError) {
-	// nothing to validate at the moment
+	if a.LaunchTemplate == nil {
+		return errs
+	}
+	if name := *a.LaunchTemplate; !launchTemplateNameRegex.MatchString(name) {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
+			"%q must be 3 to 128 characters of letters, digits, and ().-/_", name), "launchTemplate"))
+	}
 	return errs
 }
 
@@ -70,14 +110,74 @@ func (a *AWS) validateSecurityGroups() (errs *apis.FieldError) {
 	return errs
 }
 
+// validateSelectorsTogether reports a provider that selects subnets without
+// security groups, or vice versa, which is almost always a mistake.
+func (a *AWS) validateSelectorsTogether() (errs *apis.FieldError) {
+	if (len(a.SubnetSelector) == 0) != (len(a.SecurityGroupSelector) == 0) {
+		errs = errs.Also(apis.ErrGeneric("subnetSelector and securityGroupSelector must be set together", "subnetSelector", "securityGroupSelector"))
+	}
+	return errs
+}
+
 func (a *AWS) validateTags() (errs *apis.FieldError) {
-	// Avoiding a check on number of tags (hard limit of 50) since that limit is shared by user
-	// defined and Karpenter tags, and the latter could change over time.
+	// The tag limit is shared by user defined and Karpenter managed tags
+	if count := mergedTagCount(a.Tags); count > MaxTagCount {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
+			"%d tags including those applied by Karpenter exceeds the AWS limit of %d", count, MaxTagCount), "tags"))
+	}
 	for tagKey, tagValue := range a.Tags {
 		if tagKey == "" {
 			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
 				"the tag with key : '' and value : '%s' is invalid because empty tag keys aren't supported", tagValue), "tags"))
 		}
+		if !isPrintable(tagKey) || !isPrintable(tagValue) {
+			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
+				"the tag with key : %q and value : %q is invalid because tags must be printable UTF-8", tagKey, tagValue), "tags"))
+		}
 	}
 	return errs
 }
+
+// isPrintable returns true if the string is valid UTF-8 without control or
+// other non-printable characters
+func isPrintable(s string) bool {
+	return utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) == -1
+}
+
+// TagCountWarning returns a warning if the number of tags exceeds the threshold,
+// or "" if it does not or the threshold is disabled. AWS limits resources to 50
+// tags, which are shared with the tags Karpenter applies, so a threshold below
+// the limit leaves headroom for them.
+func (a *AWS) TagCountWarning(threshold int) string {
+	if threshold <= 0 || len(a.Tags) <= threshold {
+		return ""
+	}
+	return fmt.Sprintf("provider.tags has %d tags, exceeding the recommended maximum of %d to leave room for tags applied by Karpenter within the AWS limit of %d", len(a.Tags), threshold, MaxTagCount)
+}
+
+// SelectorsWarning returns a warning if the subnet and security group selectors
+// are identical, or "" if they differ. Identical selectors are valid, but may
+// be a copy-paste error where the security group selector was meant to differ.
+// The cluster discovery selector both default to is not warned about.
+func (a *AWS) SelectorsWarning() string {
+	if len(a.SubnetSelector) == 0 || len(a.SubnetSelector) != len(a.SecurityGroupSelector) || isClusterDiscoverySelector(a.SubnetSelector) {
+		return ""
+	}
+	for key, value := range a.SubnetSelector {
+		if securityGroupValue, ok := a.SecurityGroupSelector[key]; !ok || securityGroupValue != value {
+			return ""
+		}
+	}
+	return "provider.subnetSelector and provider.securityGroupSelector are identical, check that the security group selector was not copied from the subnet selector by mistake"
+}
+
+// isClusterDiscoverySelector returns true if the selector only selects by the
+// cluster discovery tag key, as the defaulted selectors do.
+func isClusterDiscoverySelector(selector map[string]string) bool {
+	for key, value := range selector {
+		if len(selector) != 1 || value != "*" || !strings.HasPrefix(key, fmt.Sprintf(ClusterDiscoveryTagKeyFormat, "")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestV1Alpha1(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CloudProvider/AWS/v1alpha1")
+}
+
+var _ = Describe("Validation", func() {
+	var provider *AWS
+
+	BeforeEach(func() {
+		provider = &AWS{
+			InstanceProfile:       "test-instance-profile",
+			SubnetSelector:        map[string]string{"foo": "bar"},
+			SecurityGroupSelector: map[string]string{"foo": "bar"},
+		}
+	})
+
+	It("should succeed for a valid provider", func() {
+		Expect(provider.Validate()).To(BeNil())
+	})
+
+	Context("Selectors", func() {
+		It("should fail when only the subnet selector is set", func() {
+			provider.SecurityGroupSelector = map[string]string{}
+			err := provider.Validate()
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("subnetSelector and securityGroupSelector must be set together"))
+		})
+		It("should fail when only the security group selector is set", func() {
+			provider.SubnetSelector = nil
+			err := provider.Validate()
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("subnetSelector and securityGroupSelector must be set together"))
+			Expect(err.Error()).To(ContainSubstring("missing field(s): provider.subnetSelector"))
+		})
+		It("should succeed for wildcard values, which select by tag key", func() {
+			provider.SubnetSelector = map[string]string{"kubernetes.io/cluster/test-cluster": "*"}
+			provider.SecurityGroupSelector = map[string]string{"kubernetes.io/cluster/test-cluster": "*", "Name": "test-security-group"}
+			Expect(provider.Validate()).To(BeNil())
+		})
+		It("should warn when the selectors are identical", func() {
+			Expect(provider.SelectorsWarning()).To(ContainSubstring("are identical"))
+			Expect(provider.Validate()).To(BeNil())
+		})
+		It("should not warn when the selectors are defaulted to the cluster discovery tag", func() {
+			provider.SubnetSelector = nil
+			provider.SecurityGroupSelector = nil
+			constraints := &Constraints{AWS: provider}
+			constraints.defaultSubnets("test-cluster")
+			constraints.defaultSecurityGroups("test-cluster")
+			Expect(provider.SubnetSelector).To(Equal(provider.SecurityGroupSelector))
+			Expect(provider.SelectorsWarning()).To(BeEmpty())
+		})
+		It("should not warn when the selectors are distinct", func() {
+			for _, securityGroupSelector := range []map[string]string{{"foo": "baz"}, {"baz": "bar"}, {"foo": "bar", "baz": "qux"}} {
+				provider.SecurityGroupSelector = securityGroupSelector
+				Expect(provider.SelectorsWarning()).To(BeEmpty())
+			}
+		})
+	})
+
+	Context("Launch Template", func() {
+		It("should succeed for valid names", func() {
+			for _, name := range []string{"abc", "my-launch-template_1.0", "team/app(prod)", strings.Repeat("a", 128)} {
+				provider.LaunchTemplate = aws.String(name)
+				Expect(provider.Validate()).To(BeNil(), name)
+			}
+		})
+		It("should fail for invalid names", func() {
+			for _, name := range []string{"", "ab", "my launch template", "template:1", "テンプレート", strings.Repeat("a", 129)} {
+				provider.LaunchTemplate = aws.String(name)
+				err := provider.Validate()
+				Expect(err).ToNot(BeNil(), name)
+				Expect(err.Error()).To(ContainSubstring("provider.launchTemplate"))
+			}
+		})
+	})
+
+	Context("Tags", func() {
+		It("should warn when tags exceed the threshold", func() {
+			provider.Tags = map[string]string{}
+			for i := 0; i < 40; i++ {
+				provider.Tags[fmt.Sprintf("tag-%d", i)] = "value"
+			}
+			Expect(provider.TagCountWarning(40)).To(BeEmpty())
+			provider.Tags["tag-40"] = "value"
+			Expect(provider.TagCountWarning(40)).To(ContainSubstring("41 tags"))
+			Expect(provider.Validate()).To(BeNil())
+		})
+		It("should fail when tags exceed the limit including managed tags", func() {
+			provider.Tags = map[string]string{}
+			for i := 0; i < MaxTagCount-len(managedTagKeyFormats); i++ {
+				provider.Tags[fmt.Sprintf("tag-%d", i)] = "value"
+			}
+			Expect(provider.Validate()).To(BeNil())
+			provider.Tags["one-too-many"] = "value"
+			err := provider.Validate()
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("51 tags including those applied by Karpenter exceeds the AWS limit of 50"))
+		})
+		It("should not count managed tags overridden by user tags towards the limit", func() {
+			provider.Tags = map[string]string{
+				NameTagKey: "custom-name",
+				fmt.Sprintf(ClusterTagKeyFormat, "test-cluster"): "owned",
+			}
+			for i := len(provider.Tags); i < MaxTagCount-1; i++ {
+				provider.Tags[fmt.Sprintf("tag-%d", i)] = "value"
+			}
+			Expect(provider.Validate()).To(BeNil())
+		})
+		It("should succeed for unicode tags", func() {
+			provider.Tags = map[string]string{"チーム": "café ☕"}
+			Expect(provider.Validate()).To(BeNil())
+		})
+		It("should fail for tags with control characters", func() {
+			for _, tags := range []map[string]string{{"team\x00": "bar"}, {"team": "bar\n"}, {"team": "\xff"}} {
+				provider.Tags = tags
+				err := provider.Validate()
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("tags must be printable UTF-8"))
+			}
+		})
+		It("should not warn when the threshold is disabled", func() {
+			provider.Tags = map[string]string{"foo": "bar"}
+			Expect(provider.TagCountWarning(0)).To(BeEmpty())
+		})
+	})
+
+	Context("Metrics", func() {
+		It("should count validation errors per failing field", func() {
+			subnetErrors := testutil.ToFloat64(validationErrorsCounter.WithLabelValues("subnetSelector"))
+			securityGroupErrors := testutil.ToFloat64(validationErrorsCounter.WithLabelValues("securityGroupSelector"))
+			tagErrors := testutil.ToFloat64(validationErrorsCounter.WithLabelValues("tags"))
+
+			provider.SubnetSelector = map[string]string{"foo": ""}
+			provider.Tags = map[string]string{"": "bar"}
+			Expect(provider.Validate()).ToNot(BeNil())
+
+			Expect(testutil.ToFloat64(validationErrorsCounter.WithLabelValues("subnetSelector"))).To(Equal(subnetErrors + 1))
+			Expect(testutil.ToFloat64(validationErrorsCounter.WithLabelValues("securityGroupSelector"))).To(Equal(securityGroupErrors))
+			Expect(testutil.ToFloat64(validationErrorsCounter.WithLabelValues("tags"))).To(Equal(tagErrors + 1))
+		})
+	})
+})
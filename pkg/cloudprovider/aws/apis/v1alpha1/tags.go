@@ -17,6 +17,7 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -25,16 +26,44 @@ import (
 )
 
 const (
+	// NameTagKey is set on all Karpenter owned resources.
+	NameTagKey = "Name"
 	// ClusterTagKeyFormat is set on all Kubernetes owned resources.
 	ClusterTagKeyFormat = "kubernetes.io/cluster/%s"
 	// KarpenterTagKeyFormat is set on all Karpenter owned resources.
 	KarpenterTagKeyFormat = "karpenter.sh/cluster/%s"
+	// MaxTagCount is the maximum number of tags AWS allows on a resource.
+	MaxTagCount = 50
 )
 
+// managedTagKeyFormats are the keys of the tags MergeTags sets on all Karpenter
+// owned resources, which count towards MaxTagCount unless overridden.
+var managedTagKeyFormats = []string{NameTagKey, ClusterTagKeyFormat, KarpenterTagKeyFormat}
+
+// mergedTagCount returns the number of tags MergeTags will produce for the
+// custom tags. Cluster names are not known during validation, so a custom tag
+// overrides a managed tag for any cluster.
+func mergedTagCount(customTags map[string]string) int {
+	count := len(customTags)
+	for _, format := range managedTagKeyFormats {
+		overridden := false
+		for key := range customTags {
+			if key == format || (strings.HasSuffix(format, "%s") && strings.HasPrefix(key, strings.TrimSuffix(format, "%s"))) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			count++
+		}
+	}
+	return count
+}
+
 func MergeTags(ctx context.Context, customTags map[string]string) []*ec2.Tag {
 	// We'll set some default tags, but allow them to be overridden in the merge
 	managedTags := map[string]string{
-		"Name": fmt.Sprintf("karpenter.sh/cluster/%s/provisioner/%s",
+		NameTagKey: fmt.Sprintf("karpenter.sh/cluster/%s/provisioner/%s",
 			injection.GetOptions(ctx).ClusterName, injection.GetNamespacedName(ctx).Name),
 		fmt.Sprintf(ClusterTagKeyFormat, injection.GetOptions(ctx).ClusterName):   "owned",
 		fmt.Sprintf(KarpenterTagKeyFormat, injection.GetOptions(ctx).ClusterName): "owned",
@@ -28,6 +28,7 @@ import (
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/cloudprovider"
 	"github.com/aws/karpenter/pkg/cloudprovider/aws/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/utils/injection"
 	"github.com/aws/karpenter/pkg/utils/project"
 
 	"go.uber.org/multierr"
@@ -142,6 +143,12 @@ func (c *CloudProvider) Validate(ctx context.Context, constraints *v1alpha5.Cons
 	if err != nil {
 		return apis.ErrGeneric(err.Error())
 	}
+	if warning := vendorConstraints.AWS.TagCountWarning(injection.GetOptions(ctx).AWSTagCountWarningThreshold); warning != "" {
+		logging.FromContext(ctx).Warn(warning)
+	}
+	if warning := vendorConstraints.AWS.SelectorsWarning(); warning != "" {
+		logging.FromContext(ctx).Warn(warning)
+	}
 	return vendorConstraints.AWS.Validate()
 }
 
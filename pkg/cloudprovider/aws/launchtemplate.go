@@ -236,7 +236,7 @@ exec > >(tee /var/log/user-data.log|logger -t user-data -s 2>/dev/console) 2>&1
     --apiserver-endpoint '%s'`,
 		injection.GetOptions(ctx).ClusterName,
 		containerRuntimeArg,
-		injection.GetOptions(ctx).ClusterEndpoint))
+		injection.GetOptions(ctx).Endpoints()[0]))
 	caBundle, err := p.GetCABundle(ctx)
 	if err != nil {
 		return "", fmt.Errorf("getting ca bundle for user data, %w", err)
@@ -19,6 +19,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/Pallinder/go-randomdata"
 	"github.com/aws/amazon-vpc-resource-controller-k8s/pkg/aws/vpc"
@@ -65,9 +66,13 @@ func TestAPIs(t *testing.T) {
 var _ = BeforeSuite(func() {
 	env = test.NewEnvironment(ctx, func(e *test.Environment) {
 		opts := options.Options{
-			ClusterName:           "test-cluster",
-			ClusterEndpoint:       "https://test-cluster",
-			AWSNodeNameConvention: "ip-name",
+			ClusterName:                 "test-cluster",
+			ClusterEndpoint:             "https://test-cluster",
+			Namespace:                   "karpenter",
+			AWSNodeNameConvention:       "ip-name",
+			MetricsReconcileConcurrency: 1,
+			MetricsReadTimeout:          30 * time.Second,
+			MetricsWriteTimeout:         30 * time.Second,
 		}
 		Expect(opts.Validate()).To(Succeed(), "Failed to validate options")
 		ctx = injection.WithOptions(ctx, opts)
@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/aws/karpenter/pkg/utils/injection"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	controllerruntime "sigs.k8s.io/controller-runtime"
@@ -39,6 +41,11 @@ func NewManagerOrDie(ctx context.Context, config *rest.Config, options controlle
 	if err := newManager.GetFieldIndexer().IndexField(ctx, &v1.Pod{}, "spec.nodeName", podSchedulingIndex); err != nil {
 		panic(fmt.Sprintf("Failed to setup pod indexer, %s", err.Error()))
 	}
+	// Metrics are served in place of the controller-runtime metrics server, which
+	// does not support timeouts. A custom path is served in addition to /metrics.
+	if err := newManager.Add(metrics.NewServerFromOptions(injection.GetOptions(ctx))); err != nil {
+		panic(fmt.Sprintf("Failed to setup metrics server, %s", err.Error()))
+	}
 	return &GenericControllerManager{Manager: newManager}
 }
 
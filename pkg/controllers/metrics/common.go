@@ -15,23 +15,44 @@ limitations under the License.
 package metrics
 
 import (
-	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"context"
+	"sync"
+
 	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 const (
 	controllerName = "metrics"
 
-	metricSubsystemCapacity = "capacity"
-	metricSubsystemPods     = "pods"
+	metricSubsystemCapacity    = "capacity"
+	metricSubsystemNamespace   = "namespace"
+	metricSubsystemNodes       = "nodes"
+	metricSubsystemPods        = "pods"
+	metricSubsystemProvisioner = "provisioner"
 
-	metricLabelArch         = "arch"
-	metricLabelInstanceType = "instancetype"
-	metricLabelPhase        = "phase"
-	metricLabelProvisioner  = metrics.ProvisionerLabel
-	metricLabelZone         = "zone"
+	metricLabelArch                  = "arch"
+	metricLabelDaemonSet             = "daemonset"
+	metricLabelInstanceID            = "instance_id"
+	metricLabelInstanceType          = "instancetype"
+	metricLabelMessage               = "message"
+	metricLabelNamespace             = "namespace"
+	metricLabelNode                  = "node"
+	metricLabelOwner                 = "owner"
+	metricLabelOwnerKind             = "owner_kind"
+	metricLabelOwnerName             = "owner_name"
+	metricLabelPhase                 = "phase"
+	metricLabelPod                   = "pod"
+	metricLabelProvisioner           = metrics.ProvisionerLabel
+	metricLabelProvisionerGeneration = "provisioner_generation"
+	metricLabelResource              = "resource"
+	metricLabelResourceType          = "resource_type"
+	metricLabelZone                  = "zone"
 
 	nodeLabelArch         = v1.LabelArchStable
 	nodeLabelInstanceType = v1.LabelInstanceTypeStable
@@ -40,7 +61,17 @@ const (
 	nodeConditionTypeReady = v1.NodeReady
 )
 
-var nodeLabelProvisioner = v1alpha5.ProvisionerNameLabelKey
+// requiredNodeLabels are the node labels that metrics are labeled with, which
+// may be missing for a moment after a node registers.
+var requiredNodeLabels = []string{nodeLabelArch, nodeLabelInstanceType, nodeLabelZone}
+
+// getInterruptionTaintKey returns the node taint key that signals an imminent interruption.
+func getInterruptionTaintKey(ctx context.Context) string {
+	if key := injection.GetOptions(ctx).InterruptionTaintKey; key != "" {
+		return key
+	}
+	return options.DefaultInterruptionTaintKey
+}
 
 func publishCount(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels, count int) error {
 	gauge, err := gaugeVec.GetMetricWith(labels)
@@ -50,3 +81,96 @@ func publishCount(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels, count
 	gauge.Set(float64(count))
 	return nil
 }
+
+// getPodMetricsSelector returns the selector for pods included in pod metrics.
+func getPodMetricsSelector(ctx context.Context) labels.Selector {
+	selector, err := labels.Parse(injection.GetOptions(ctx).PodMetricsSelector)
+	if err != nil {
+		// Options are validated at startup, so this is not expected
+		return labels.Everything()
+	}
+	return selector
+}
+
+// seriesCount is the count to publish for a single series of a GaugeVec.
+type seriesCount struct {
+	labels prometheus.Labels
+	count  int
+}
+
+// seriesValue is the value to publish for a single series of a GaugeVec.
+type seriesValue struct {
+	labels prometheus.Labels
+	value  float64
+}
+
+// publishedSeries records the label sets last published to each GaugeVec by
+// provisioner, so series for label values that are no longer observed can be
+// deleted rather than left at a stale count.
+var publishedSeries = struct {
+	sync.Mutex
+	labels map[*prometheus.GaugeVec]map[string]map[string]prometheus.Labels
+}{labels: map[*prometheus.GaugeVec]map[string]map[string]prometheus.Labels{}}
+
+// publishSeries publishes the given series for the provisioner and deletes any
+// series previously published for the provisioner that are absent from counts.
+func publishSeries(gaugeVec *prometheus.GaugeVec, provisioner string, counts []seriesCount) error {
+	values := make([]seriesValue, 0, len(counts))
+	for _, series := range counts {
+		values = append(values, seriesValue{labels: series.labels, value: float64(series.count)})
+	}
+	return publishSeriesValues(gaugeVec, provisioner, values)
+}
+
+// publishSeriesValues is publishSeries for values that are not counts.
+func publishSeriesValues(gaugeVec *prometheus.GaugeVec, provisioner string, values []seriesValue) error {
+	publishedSeries.Lock()
+	defer publishedSeries.Unlock()
+
+	errors := make([]error, 0, len(values))
+	current := map[string]prometheus.Labels{}
+	for _, series := range values {
+		gauge, err := gaugeVec.GetMetricWith(series.labels)
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			gauge.Set(series.value)
+		}
+		current[labels.Set(series.labels).String()] = series.labels
+	}
+	if publishedSeries.labels[gaugeVec] == nil {
+		publishedSeries.labels[gaugeVec] = map[string]map[string]prometheus.Labels{}
+	}
+	for key, previous := range publishedSeries.labels[gaugeVec][provisioner] {
+		if _, ok := current[key]; !ok {
+			gaugeVec.Delete(previous)
+		}
+	}
+	publishedSeries.labels[gaugeVec][provisioner] = current
+	return multierr.Combine(errors...)
+}
+
+// deleteSeries deletes all series previously published for the provisioner.
+func deleteSeries(gaugeVec *prometheus.GaugeVec, provisioner string) {
+	publishedSeries.Lock()
+	defer publishedSeries.Unlock()
+
+	for _, previous := range publishedSeries.labels[gaugeVec][provisioner] {
+		gaugeVec.Delete(previous)
+	}
+	delete(publishedSeries.labels[gaugeVec], provisioner)
+}
+
+// deleteAllSeries deletes the series previously published for the provisioner
+// to every GaugeVec.
+func deleteAllSeries(provisioner string) {
+	publishedSeries.Lock()
+	defer publishedSeries.Unlock()
+
+	for gaugeVec, seriesByProvisioner := range publishedSeries.labels {
+		for _, previous := range seriesByProvisioner[provisioner] {
+			gaugeVec.Delete(previous)
+		}
+		delete(seriesByProvisioner, provisioner)
+	}
+}
@@ -20,11 +20,15 @@ import (
 
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/cloudprovider"
+	"github.com/aws/karpenter/pkg/metrics"
 	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/node"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/workqueue"
 	"knative.dev/pkg/logging"
@@ -35,19 +39,26 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// incompleteNodeLabelsRequeueAfter is how long to wait for newly registered
+// nodes to be labeled before publishing metrics.
+const incompleteNodeLabelsRequeueAfter = time.Second
+
 type Controller struct {
 	CloudProvider cloudprovider.CloudProvider
 	KubeClient    client.Client
+	Clock         clock.Clock
 }
 
 func NewController(kubeClient client.Client, cloudProvider cloudprovider.CloudProvider) *Controller {
 	return &Controller{
 		CloudProvider: cloudProvider,
 		KubeClient:    kubeClient,
+		Clock:         clock.RealClock{},
 	}
 }
 
-func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
+	defer func() { metrics.ObserveRequeue(controllerName, result, err) }()
 	ctx = logging.WithLogger(ctx, zap.NewNop().Sugar())
 	ctx = injection.WithControllerName(ctx, controllerName)
 
@@ -60,7 +71,25 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		}
 
 		// The provisioner has been deleted.
-		return reconcile.Result{}, nil
+		forgetProvisioner(req.Name)
+		return reconcile.Result{}, deleteCounts(req.Name)
+	}
+	observeProvisioner(req.Name)
+
+	// Metrics are not published for provisioners outside of the allowlist.
+	if !injection.GetOptions(ctx).MetricsProvisionerAllowed(req.Name) {
+		return reconcile.Result{}, deleteCounts(req.Name)
+	}
+
+	// Wait for newly registered nodes to be labeled, so their first series are complete.
+	if injection.GetOptions(ctx).MetricsRequireNodeLabels {
+		incomplete, err := c.hasIncompleteNodes(ctx, provisioner)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if incomplete {
+			return reconcile.Result{RequeueAfter: incompleteNodeLabelsRequeueAfter}, nil
+		}
 	}
 
 	// The provisioner does exist, so update counters.
@@ -72,21 +101,56 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
 }
 
-func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+// hasIncompleteNodes returns true if any node of the provisioner is missing a
+// label that metrics are labeled with.
+func (c *Controller) hasIncompleteNodes(ctx context.Context, provisioner *v1alpha5.Provisioner) (bool, error) {
+	nodes, err := c.nodesForProvisioner(ctx, provisioner)
+	if err != nil {
+		return false, err
+	}
+	for _, node := range nodes {
+		for _, key := range requiredNodeLabels {
+			if _, ok := node.Labels[key]; !ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// deleteCounts deletes all series published for the provisioner.
+func deleteCounts(provisioner string) error {
+	deleteNodeCounts(provisioner)
+	deletePendingPodCount(provisioner)
+	deleteEvictedPodCount(provisioner)
+	deletePendingDurations(provisioner)
+	deleteZoneCounts(provisioner)
+	deleteAllSeries(provisioner)
+	return deleteClusterUtilization(provisioner)
+}
+
+func (c *Controller) Register(ctx context.Context, m manager.Manager) error {
 	return controllerruntime.
 		NewControllerManagedBy(m).
 		Named(controllerName).
 		For(&v1alpha5.Provisioner{}).
-		WithOptions(controller.Options{
-			MaxConcurrentReconciles: 10,
-		}).
+		WithOptions(controllerOptions(ctx)).
 		Complete(c)
 }
 
+func controllerOptions(ctx context.Context) controller.Options {
+	return controller.Options{
+		MaxConcurrentReconciles: injection.GetOptions(ctx).MetricsReconcileConcurrency,
+		RateLimiter:             injection.GetOptions(ctx).ReconcileRateLimiter(),
+	}
+}
+
 func (c *Controller) updateCounts(ctx context.Context, provisioner *v1alpha5.Provisioner) error {
 	updateCountFuncs := []func(context.Context, *v1alpha5.Provisioner) error{
 		c.updateNodeCounts,
+		c.updateNodeInterruptions,
 		c.updatePodCounts,
+		c.updatePendingPodCounts,
 	}
 	updateCountFuncsLen := len(updateCountFuncs)
 	errors := make([]error, updateCountFuncsLen)
@@ -119,39 +183,102 @@ func (c *Controller) updateNodeCounts(ctx context.Context, provisioner *v1alpha5
 		nodeLabelZone:         zoneValues,
 	}
 
-	return publishNodeCounts(provisioner.Name, knownValuesForNodeLabels, func(matchingLabels client.MatchingLabels, consume nodeListConsumerFunc) error {
+	return publishNodeCounts(node.GetProvisionerLabelKey(ctx), provisioner.Name, c.Clock.Now(), knownValuesForNodeLabels, func(matchingLabels client.MatchingLabels, consume nodeListConsumerFunc) error {
 		nodes := v1.NodeList{}
 		if err := c.KubeClient.List(ctx, &nodes, matchingLabels); err != nil {
 			return err
 		}
-		return consume(nodes.Items)
+		return consume(withoutExcludedNodes(nodes.Items))
 	})
 }
 
+func (c *Controller) updateNodeInterruptions(ctx context.Context, provisioner *v1alpha5.Provisioner) error {
+	nodesForProvisioner, err := c.nodesForProvisioner(ctx, provisioner)
+	if err != nil {
+		return err
+	}
+	return multierr.Combine(
+		publishNodeInterruptions(getInterruptionTaintKey(ctx), provisioner.Name, nodesForProvisioner),
+		publishNodeInstanceInfo(injection.GetOptions(ctx).MetricsNodeInstanceInfo, provisioner.Name, nodesForProvisioner),
+		publishNodeReadiness(injection.GetOptions(ctx).NodeMetricsIncludeConditionMessage, provisioner.Name, nodesForProvisioner),
+		publishNodeTaintCounts(provisioner.Name, nodesForProvisioner),
+		publishZoneCounts(provisioner.Name, nodesForProvisioner),
+		publishBootstrapErrors(v1.NodeConditionType(injection.GetOptions(ctx).BootstrapErrorConditionType), provisioner.Name, nodesForProvisioner),
+		publishStuckTerminating(injection.GetOptions(ctx).StuckTerminatingThreshold, provisioner.Name, c.Clock.Now(), nodesForProvisioner),
+		publishNodeGenerationCounts(injection.GetOptions(ctx).MetricsProvisionerGeneration, provisioner.Name, nodesForProvisioner),
+	)
+}
+
 func (c *Controller) updatePodCounts(ctx context.Context, provisioner *v1alpha5.Provisioner) error {
-	podsForProvisioner, err := c.podsForProvisioner(ctx, provisioner)
+	nodesForProvisioner, err := c.nodesForProvisioner(ctx, provisioner)
+	if err != nil {
+		return err
+	}
+	podsForProvisioner, err := c.podsForNodes(ctx, nodesForProvisioner)
 	if err != nil {
 		return err
 	}
+	daemonSetList := appsv1.DaemonSetList{}
+	if err := c.KubeClient.List(ctx, &daemonSetList); err != nil {
+		return err
+	}
+	// Daemon pods are compared before the pod metrics selector is applied
+	if err := publishMissingDaemons(provisioner.Name, nodesForProvisioner, daemonSetList.Items, podsForProvisioner); err != nil {
+		return err
+	}
+	podsForProvisioner = selectPods(getPodMetricsSelector(ctx), podsForProvisioner)
 
-	return publishPodCounts(provisioner.Name, podsForProvisioner)
+	return multierr.Combine(
+		publishPodCounts(provisioner.Name, podsForProvisioner),
+		publishPodRestarts(provisioner.Name, podsForProvisioner),
+		publishPodRestartsByPod(injection.GetOptions(ctx).MetricsPodRestartsByPod, provisioner.Name, podsForProvisioner),
+		publishNamespacePodRequests(provisioner.Name, podsForProvisioner),
+		countEvictedPods(provisioner.Name, podsForProvisioner),
+		observePendingDurations(provisioner.Name, podsForProvisioner),
+		publishWorkloadPodCounts(provisioner.Name, selectNonTerminalPods(injection.GetOptions(ctx).PodMetricsIncludeTerminal, podsForProvisioner)),
+		publishPodsMissingRequests(provisioner.Name, podsForProvisioner),
+		publishPodZoneDistribution(provisioner.Name, podsForProvisioner, nodesForProvisioner),
+		publishEphemeralStorageHeadroom(provisioner.Name, nodesForProvisioner, podsForProvisioner),
+		publishPodsHeadroom(provisioner.Name, nodesForProvisioner, podsForProvisioner),
+		publishPodDensity(provisioner.Name, nodesForProvisioner, podsForProvisioner),
+		publishClusterUtilization(provisioner.Name, nodesForProvisioner, podsForProvisioner),
+		publishConsolidationCandidates(injection.GetOptions(ctx).ConsolidationUtilizationThreshold, provisioner.Name, nodesForProvisioner, podsForProvisioner),
+	)
 }
 
-// podsForProvisioner returns a map of slices containing all pods scheduled to nodes in each zone.
-func (c *Controller) podsForProvisioner(ctx context.Context, provisioner *v1alpha5.Provisioner) ([]v1.Pod, error) {
-	// Karpenter does not apply a label, or other marker, to pods.
-
-	results := []v1.Pod{}
+func (c *Controller) updatePendingPodCounts(ctx context.Context, provisioner *v1alpha5.Provisioner) error {
+	podList := v1.PodList{}
+	withoutNodeName := client.MatchingFields{"spec.nodeName": ""}
+	if err := c.KubeClient.List(ctx, &podList, withoutNodeName); err != nil {
+		return err
+	}
+	nodeList := v1.NodeList{}
+	if err := c.KubeClient.List(ctx, &nodeList); err != nil {
+		return err
+	}
+	pendingPods := selectPods(getPodMetricsSelector(ctx), podList.Items)
+	return multierr.Combine(
+		publishPendingPodCounts(node.GetProvisionerLabelKey(ctx), provisioner.Name, pendingPods),
+		publishPodsWaitingForVolumeZone(node.GetProvisionerLabelKey(ctx), provisioner.Name, pendingPods, nodeList.Items),
+	)
+}
 
-	// 1. Fetch all nodes associated with the provisioner.
+// nodesForProvisioner returns all nodes associated with the provisioner that
+// are not excluded from metrics.
+func (c *Controller) nodesForProvisioner(ctx context.Context, provisioner *v1alpha5.Provisioner) ([]v1.Node, error) {
 	nodeList := v1.NodeList{}
-	withProvisionerName := client.MatchingLabels{nodeLabelProvisioner: provisioner.Name}
+	withProvisionerName := client.MatchingLabels{node.GetProvisionerLabelKey(ctx): provisioner.Name}
 	if err := c.KubeClient.List(ctx, &nodeList, withProvisionerName); err != nil {
 		return nil, err
 	}
+	return withoutExcludedNodes(nodeList.Items), nil
+}
 
-	// 2. Get all the pods scheduled to each node.
-	for _, node := range nodeList.Items {
+// podsForNodes returns all pods scheduled to the nodes.
+func (c *Controller) podsForNodes(ctx context.Context, nodes []v1.Node) ([]v1.Pod, error) {
+	// Karpenter does not apply a label, or other marker, to pods.
+	results := []v1.Pod{}
+	for _, node := range nodes {
 		podList := v1.PodList{}
 		withNodeName := client.MatchingFields{"spec.nodeName": node.Name}
 		if err := c.KubeClient.List(ctx, &podList, withNodeName); err != nil {
@@ -160,6 +287,5 @@ func (c *Controller) podsForProvisioner(ctx context.Context, provisioner *v1alph
 
 		results = append(results, podList.Items...)
 	}
-
 	return results, nil
 }
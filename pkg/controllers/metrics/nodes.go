@@ -15,10 +15,23 @@ limitations under the License.
 package metrics
 
 import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/aws/karpenter/pkg/utils/node"
+	"github.com/aws/karpenter/pkg/utils/pod"
+	"github.com/aws/karpenter/pkg/utils/resources"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/multierr"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -95,6 +108,235 @@ var (
 			metricLabelZone,
 		},
 	)
+
+	readyNodeCountByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemProvisioner,
+			Name:      "ready_nodes",
+			Help:      "Count of nodes that are ready by provisioner.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	nodeCountByProvisionerGeneration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemProvisioner,
+			Name:      "generation_nodes",
+			Help:      "Count of nodes by provisioner and the provisioner generation they were created under.",
+		},
+		[]string{
+			metricLabelProvisioner,
+			metricLabelProvisionerGeneration,
+		},
+	)
+
+	unschedulableNodeCountByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "unschedulable",
+			Help:      "Count of nodes that are cordoned by provisioner.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	notReadySecondsByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "not_ready_seconds",
+			Help:      "Seconds since the ready condition of a node that is not ready last transitioned, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	bootstrapErrorByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "bootstrap_error",
+			Help:      "Whether a node has the configured bootstrap error condition set to True, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	readyByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "ready",
+			Help:      "Whether a node is ready, by node and provisioner. The message of the ready condition is only labeled if enabled.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+			metricLabelMessage,
+		},
+	)
+
+	ephemeralStorageHeadroomByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "ephemeral_storage_headroom",
+			Help:      "Allocatable ephemeral storage in bytes less the ephemeral storage requested by pods, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	podsHeadroomByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "pods_headroom",
+			Help:      "Allocatable pods less the non-terminal pods scheduled to a node, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	consolidationCandidateByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "consolidation_candidate",
+			Help:      "Whether the requested fraction of a node's CPU and memory is below the consolidation utilization threshold, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	instanceInfoByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "instance_info",
+			Help:      "Always 1, labeled with the instance ID from the provider ID of each node by node and provisioner.",
+		},
+		[]string{
+			metricLabelInstanceID,
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	interruptionByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "interruption",
+			Help:      "Whether a node is tainted with an imminent interruption, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	podDensityByInstancetypeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "instance_type",
+			Name:      "pod_density",
+			Help:      "Average number of non-terminal pods per node, by instance type and provisioner.",
+		},
+		[]string{
+			metricLabelInstanceType,
+			metricLabelProvisioner,
+		},
+	)
+
+	clusterUtilizationByResource = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "cluster",
+			Name:      "utilization_ratio",
+			Help:      "Ratio of requested to allocatable resources summed across all provisioned nodes, by resource.",
+		},
+		[]string{
+			metricLabelResource,
+		},
+	)
+
+	nodeZoneCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Name:      "node_zone_count",
+			Help:      "Number of distinct zones spanned by ready nodes across all provisioners.",
+		},
+	)
+
+	zoneCountByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemProvisioner,
+			Name:      "zone_count",
+			Help:      "Number of distinct zones spanned by ready nodes, by provisioner.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	stuckTerminatingByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "stuck_terminating",
+			Help:      "Whether a node has been deleting for longer than the stuck terminating threshold, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	taintCountByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "taint_count",
+			Help:      "Number of taints on a node, by node and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelProvisioner,
+		},
+	)
+
+	missingDaemonsByNodeProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNodes,
+			Name:      "missing_daemons",
+			Help:      "Whether a daemonset expected to run on a node has no pod on it, by node, daemonset, and provisioner.",
+		},
+		[]string{
+			metricLabelNode,
+			metricLabelNamespace,
+			metricLabelDaemonSet,
+			metricLabelProvisioner,
+		},
+	)
 )
 
 func init() {
@@ -103,48 +345,69 @@ func init() {
 	crmetrics.Registry.MustRegister(readyNodeCountByArchProvisionerZone)
 	crmetrics.Registry.MustRegister(readyNodeCountByInstancetypeProvisionerZone)
 	crmetrics.Registry.MustRegister(readyNodeCountByOsProvisionerZone)
+	crmetrics.Registry.MustRegister(readyNodeCountByProvisioner)
+	crmetrics.Registry.MustRegister(nodeCountByProvisionerGeneration)
+	crmetrics.Registry.MustRegister(unschedulableNodeCountByProvisioner)
+	crmetrics.Registry.MustRegister(notReadySecondsByNodeProvisioner)
+	crmetrics.Registry.MustRegister(readyByNodeProvisioner)
+	crmetrics.Registry.MustRegister(bootstrapErrorByNodeProvisioner)
+	crmetrics.Registry.MustRegister(ephemeralStorageHeadroomByNodeProvisioner)
+	crmetrics.Registry.MustRegister(podsHeadroomByNodeProvisioner)
+	crmetrics.Registry.MustRegister(consolidationCandidateByNodeProvisioner)
+	crmetrics.Registry.MustRegister(instanceInfoByNodeProvisioner)
+	crmetrics.Registry.MustRegister(interruptionByNodeProvisioner)
+	crmetrics.Registry.MustRegister(taintCountByNodeProvisioner)
+	crmetrics.Registry.MustRegister(missingDaemonsByNodeProvisioner)
+	crmetrics.Registry.MustRegister(stuckTerminatingByNodeProvisioner)
+	crmetrics.Registry.MustRegister(podDensityByInstancetypeProvisioner)
+	crmetrics.Registry.MustRegister(clusterUtilizationByResource)
+	crmetrics.Registry.MustRegister(nodeZoneCount)
+	crmetrics.Registry.MustRegister(zoneCountByProvisioner)
 }
 
-func publishNodeCounts(provisioner string, knownValuesForNodeLabels map[string]sets.String, consumeNodesWith consumeNodesWithFunc) error {
+func publishNodeCounts(provisionerLabelKey string, provisioner string, now time.Time, knownValuesForNodeLabels map[string]sets.String, consumeNodesWith consumeNodesWithFunc) error {
 	archValues := knownValuesForNodeLabels[nodeLabelArch]
 	instanceTypeValues := knownValuesForNodeLabels[nodeLabelInstanceType]
 	zoneValues := knownValuesForNodeLabels[nodeLabelZone]
 
 	errors := make([]error, 0, len(archValues)*len(instanceTypeValues)*len(zoneValues))
 
-	nodeLabels := client.MatchingLabels{nodeLabelProvisioner: provisioner}
+	nodeLabels := client.MatchingLabels{provisionerLabelKey: provisioner}
 	errors = append(errors, consumeNodesWith(nodeLabels, func(nodes []v1.Node) error {
-		return publishCount(nodeCountByProvisioner, metricLabelsFrom(nodeLabels), len(nodes))
+		return multierr.Combine(
+			publishProvisionerNodeCounts(metricLabelsFrom(provisionerLabelKey, nodeLabels), nodes),
+			publishNotReadySeconds(provisioner, now, nodes),
+		)
 	}))
 
 	for zone := range zoneValues {
 		nodeLabels = client.MatchingLabels{
-			nodeLabelProvisioner: provisioner,
-			nodeLabelZone:        zone,
+			provisionerLabelKey: provisioner,
+			nodeLabelZone:       zone,
 		}
 		errors = append(errors, consumeNodesWith(nodeLabels, filterReadyNodes(func(readyNodes []v1.Node) error {
-			return publishCount(readyNodeCountByProvisionerZone, metricLabelsFrom(nodeLabels), len(readyNodes))
+			return publishCount(readyNodeCountByProvisionerZone, metricLabelsFrom(provisionerLabelKey, nodeLabels), len(readyNodes))
 		})))
 
 		for arch := range archValues {
 			nodeLabels := client.MatchingLabels{
-				nodeLabelArch:        arch,
-				nodeLabelProvisioner: provisioner,
-				nodeLabelZone:        zone,
+				nodeLabelArch:       arch,
+				provisionerLabelKey: provisioner,
+				nodeLabelZone:       zone,
 			}
 			errors = append(errors, consumeNodesWith(nodeLabels, filterReadyNodes(func(readyNodes []v1.Node) error {
-				return publishCount(readyNodeCountByArchProvisionerZone, metricLabelsFrom(nodeLabels), len(readyNodes))
+				return publishCount(readyNodeCountByArchProvisionerZone, metricLabelsFrom(provisionerLabelKey, nodeLabels), len(readyNodes))
 			})))
 		}
 
 		for instanceType := range instanceTypeValues {
 			nodeLabels := client.MatchingLabels{
 				nodeLabelInstanceType: instanceType,
-				nodeLabelProvisioner:  provisioner,
+				provisionerLabelKey:   provisioner,
 				nodeLabelZone:         zone,
 			}
 			errors = append(errors, consumeNodesWith(nodeLabels, filterReadyNodes(func(readyNodes []v1.Node) error {
-				return publishCount(readyNodeCountByInstancetypeProvisionerZone, metricLabelsFrom(nodeLabels), len(readyNodes))
+				return publishCount(readyNodeCountByInstancetypeProvisionerZone, metricLabelsFrom(provisionerLabelKey, nodeLabels), len(readyNodes))
 			})))
 		}
 	}
@@ -152,6 +415,585 @@ func publishNodeCounts(provisioner string, knownValuesForNodeLabels map[string]s
 	return multierr.Combine(errors...)
 }
 
+// publishProvisionerNodeCounts publishes the node counts that are labeled only by provisioner.
+func publishProvisionerNodeCounts(metricLabels prometheus.Labels, nodes []v1.Node) error {
+	unschedulable := 0
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			unschedulable++
+		}
+	}
+	return multierr.Combine(
+		publishCount(nodeCountByProvisioner, metricLabels, len(nodes)),
+		publishCount(unschedulableNodeCountByProvisioner, metricLabels, unschedulable),
+		filterReadyNodes(func(readyNodes []v1.Node) error {
+			return publishCount(readyNodeCountByProvisioner, metricLabels, len(readyNodes))
+		})(nodes),
+	)
+}
+
+// publishNotReadySeconds publishes how long each node that is not ready has been
+// in that state as of now. Nodes whose ready condition has never transitioned
+// are measured from their creation.
+func publishNotReadySeconds(provisioner string, now time.Time, nodes []v1.Node) error {
+	series := []seriesCount{}
+	for i := range nodes {
+		if node.IsReady(&nodes[i]) {
+			continue
+		}
+		since := node.GetCondition(nodes[i].Status.Conditions, v1.NodeReady).LastTransitionTime.Time
+		if since.IsZero() {
+			since = nodes[i].CreationTimestamp.Time
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        nodes[i].Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: int(now.Sub(since).Seconds()),
+		})
+	}
+	return publishSeries(notReadySecondsByNodeProvisioner, provisioner, series)
+}
+
+// publishNodeReadiness publishes whether each node is ready. The message of the
+// ready condition is high cardinality, so it is left empty unless included.
+func publishNodeReadiness(includeMessage bool, provisioner string, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	for i := range nodes {
+		message := ""
+		if includeMessage {
+			message = node.GetCondition(nodes[i].Status.Conditions, v1.NodeReady).Message
+		}
+		ready := 0
+		if node.IsReady(&nodes[i]) {
+			ready = 1
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        nodes[i].Name,
+				metricLabelProvisioner: provisioner,
+				metricLabelMessage:     message,
+			},
+			count: ready,
+		})
+	}
+	return publishSeries(readyByNodeProvisioner, provisioner, series)
+}
+
+// publishEphemeralStorageHeadroom publishes the ephemeral storage that remains
+// unrequested on each node. Nodes without allocatable ephemeral storage are not
+// published, and the headroom is negative when a node is overcommitted.
+func publishEphemeralStorageHeadroom(provisioner string, nodes []v1.Node, podList []v1.Pod) error {
+	requestsByNode := requestsByNode(podList)
+	series := []seriesCount{}
+	for _, node := range nodes {
+		allocatable, ok := node.Status.Allocatable[v1.ResourceEphemeralStorage]
+		if !ok {
+			continue
+		}
+		allocatable.Sub(requestsByNode[node.Name][v1.ResourceEphemeralStorage])
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: int(allocatable.Value()),
+		})
+	}
+	return publishSeries(ephemeralStorageHeadroomByNodeProvisioner, provisioner, series)
+}
+
+// publishPodsHeadroom publishes the number of pods that can still be scheduled
+// to each node. Nodes without allocatable pods are not published.
+func publishPodsHeadroom(provisioner string, nodes []v1.Node, podList []v1.Pod) error {
+	podsByNode := map[string]int{}
+	for i := range podList {
+		if !pod.IsTerminal(&podList[i]) {
+			podsByNode[podList[i].Spec.NodeName]++
+		}
+	}
+	series := []seriesCount{}
+	for _, node := range nodes {
+		allocatable, ok := node.Status.Allocatable[v1.ResourcePods]
+		if !ok {
+			continue
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: int(allocatable.Value()) - podsByNode[node.Name],
+		})
+	}
+	return publishSeries(podsHeadroomByNodeProvisioner, provisioner, series)
+}
+
+// publishPodDensity publishes the average number of non-terminal pods per node
+// of each instance type. Nodes without an instance type label are not counted.
+func publishPodDensity(provisioner string, nodes []v1.Node, podList []v1.Pod) error {
+	podsByNode := map[string]int{}
+	for i := range podList {
+		if !pod.IsTerminal(&podList[i]) {
+			podsByNode[podList[i].Spec.NodeName]++
+		}
+	}
+	nodesByInstanceType := map[string]int{}
+	podsByInstanceType := map[string]int{}
+	for _, node := range nodes {
+		instanceType := node.Labels[nodeLabelInstanceType]
+		if instanceType == "" {
+			continue
+		}
+		nodesByInstanceType[instanceType]++
+		podsByInstanceType[instanceType] += podsByNode[node.Name]
+	}
+	series := make([]seriesValue, 0, len(nodesByInstanceType))
+	for instanceType, nodeCount := range nodesByInstanceType {
+		series = append(series, seriesValue{
+			labels: prometheus.Labels{
+				metricLabelInstanceType: instanceType,
+				metricLabelProvisioner:  provisioner,
+			},
+			value: float64(podsByInstanceType[instanceType]) / float64(nodeCount),
+		})
+	}
+	return publishSeriesValues(podDensityByInstancetypeProvisioner, provisioner, series)
+}
+
+// publishConsolidationCandidates publishes 1 for nodes whose utilization is
+// below the threshold and 0 for all other nodes. Nodes that have not reported
+// allocatable CPU are never candidates. If the threshold is 0, no series are
+// published.
+func publishConsolidationCandidates(threshold float64, provisioner string, nodes []v1.Node, podList []v1.Pod) error {
+	series := make([]seriesCount, 0, len(nodes))
+	if threshold == 0 {
+		return publishSeries(consolidationCandidateByNodeProvisioner, provisioner, series)
+	}
+	requestsByNode := requestsByNode(podList)
+	for _, node := range nodes {
+		candidate := 0
+		if _, ok := node.Status.Allocatable[v1.ResourceCPU]; ok && utilization(node.Status.Allocatable, requestsByNode[node.Name]) < threshold {
+			candidate = 1
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: candidate,
+		})
+	}
+	return publishSeries(consolidationCandidateByNodeProvisioner, provisioner, series)
+}
+
+// utilizationResources are the resources whose utilization is published.
+var utilizationResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// utilization returns the largest fraction of allocatable CPU or memory that
+// is requested.
+func utilization(allocatable v1.ResourceList, requests v1.ResourceList) float64 {
+	result := 0.0
+	for _, resourceName := range utilizationResources {
+		allocated, requested := allocatable[resourceName], requests[resourceName]
+		if allocated.IsZero() {
+			continue
+		}
+		result = math.Max(result, requested.AsApproximateFloat64()/allocated.AsApproximateFloat64())
+	}
+	return result
+}
+
+// clusterResources records the allocatable and requested resources of the nodes
+// of each provisioner, which are summed into the cluster wide utilization.
+var clusterResources = struct {
+	sync.Mutex
+	allocatable map[string]v1.ResourceList
+	requested   map[string]v1.ResourceList
+}{allocatable: map[string]v1.ResourceList{}, requested: map[string]v1.ResourceList{}}
+
+// publishClusterUtilization records the resources of the provisioner's nodes
+// and publishes the utilization summed across all provisioners.
+func publishClusterUtilization(provisioner string, nodes []v1.Node, podList []v1.Pod) error {
+	requestsByNode := requestsByNode(podList)
+	allocatable, requested := v1.ResourceList{}, v1.ResourceList{}
+	for _, node := range nodes {
+		allocatable = resources.Merge(allocatable, node.Status.Allocatable)
+		requested = resources.Merge(requested, requestsByNode[node.Name])
+	}
+
+	clusterResources.Lock()
+	defer clusterResources.Unlock()
+	clusterResources.allocatable[provisioner] = allocatable
+	clusterResources.requested[provisioner] = requested
+	return republishClusterUtilization()
+}
+
+// deleteClusterUtilization removes the resources of the provisioner's nodes from
+// the cluster wide utilization.
+func deleteClusterUtilization(provisioner string) error {
+	clusterResources.Lock()
+	defer clusterResources.Unlock()
+	delete(clusterResources.allocatable, provisioner)
+	delete(clusterResources.requested, provisioner)
+	return republishClusterUtilization()
+}
+
+// republishClusterUtilization must be called with clusterResources locked.
+func republishClusterUtilization() error {
+	allocatable, requested := v1.ResourceList{}, v1.ResourceList{}
+	for provisioner := range clusterResources.allocatable {
+		allocatable = resources.Merge(allocatable, clusterResources.allocatable[provisioner])
+		requested = resources.Merge(requested, clusterResources.requested[provisioner])
+	}
+	errors := make([]error, 0, len(utilizationResources))
+	for _, resourceName := range utilizationResources {
+		metricLabels := prometheus.Labels{metricLabelResource: string(resourceName)}
+		allocated, requests := allocatable[resourceName], requested[resourceName]
+		if allocated.IsZero() {
+			clusterUtilizationByResource.Delete(metricLabels)
+			continue
+		}
+		gauge, err := clusterUtilizationByResource.GetMetricWith(metricLabels)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		gauge.Set(requests.AsApproximateFloat64() / allocated.AsApproximateFloat64())
+	}
+	return multierr.Combine(errors...)
+}
+
+// clusterZones records the zones of each provisioner's ready nodes, so the
+// zones spanned across all provisioners can be counted.
+var clusterZones = struct {
+	sync.Mutex
+	zones map[string]sets.String
+}{zones: map[string]sets.String{}}
+
+// publishZoneCounts records the zones of the provisioner's ready nodes and
+// publishes the number of distinct zones for the provisioner and across all
+// provisioners.
+func publishZoneCounts(provisioner string, nodes []v1.Node) error {
+	zones := sets.NewString()
+	for i := range nodes {
+		if zone := nodes[i].Labels[nodeLabelZone]; zone != "" && node.IsReady(&nodes[i]) {
+			zones.Insert(zone)
+		}
+	}
+
+	clusterZones.Lock()
+	defer clusterZones.Unlock()
+	clusterZones.zones[provisioner] = zones
+	republishClusterZoneCount()
+	return publishCount(zoneCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner}, zones.Len())
+}
+
+// deleteZoneCounts removes the zones of the provisioner's nodes from the count
+// across all provisioners.
+func deleteZoneCounts(provisioner string) {
+	clusterZones.Lock()
+	defer clusterZones.Unlock()
+	delete(clusterZones.zones, provisioner)
+	zoneCountByProvisioner.Delete(prometheus.Labels{metricLabelProvisioner: provisioner})
+	republishClusterZoneCount()
+}
+
+// republishClusterZoneCount must be called with clusterZones locked.
+func republishClusterZoneCount() {
+	zones := sets.NewString()
+	for _, provisionerZones := range clusterZones.zones {
+		zones = zones.Union(provisionerZones)
+	}
+	nodeZoneCount.Set(float64(zones.Len()))
+}
+
+// requestsByNode returns the total requests of the pods scheduled to each node.
+func requestsByNode(podList []v1.Pod) map[string]v1.ResourceList {
+	result := map[string]v1.ResourceList{}
+	for i := range podList {
+		requests, _ := resources.PodResources(&podList[i])
+		result[podList[i].Spec.NodeName] = resources.Merge(result[podList[i].Spec.NodeName], requests)
+	}
+	return result
+}
+
+// publishNodeInterruptions publishes 1 for nodes with the interruption taint and
+// 0 for all other nodes.
+func publishNodeInterruptions(interruptionTaintKey string, provisioner string, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	for _, node := range nodes {
+		interrupted := 0
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == interruptionTaintKey {
+				interrupted = 1
+				break
+			}
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: interrupted,
+		})
+	}
+	return publishSeries(interruptionByNodeProvisioner, provisioner, series)
+}
+
+// publishBootstrapErrors publishes 1 for nodes with the condition type set to
+// True, and 0 for all other nodes. If the condition type is empty, no series
+// are published.
+func publishBootstrapErrors(conditionType v1.NodeConditionType, provisioner string, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	if conditionType == "" {
+		return publishSeries(bootstrapErrorByNodeProvisioner, provisioner, series)
+	}
+	for i := range nodes {
+		failed := 0
+		if node.GetCondition(nodes[i].Status.Conditions, conditionType).Status == v1.ConditionTrue {
+			failed = 1
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        nodes[i].Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: failed,
+		})
+	}
+	return publishSeries(bootstrapErrorByNodeProvisioner, provisioner, series)
+}
+
+// publishStuckTerminating publishes 1 for nodes that have been deleting for
+// longer than the threshold as of now, and 0 for all other nodes. If the
+// threshold is 0, no series are published.
+func publishStuckTerminating(threshold time.Duration, provisioner string, now time.Time, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	if threshold == 0 {
+		return publishSeries(stuckTerminatingByNodeProvisioner, provisioner, series)
+	}
+	for _, node := range nodes {
+		stuck := 0
+		if node.DeletionTimestamp != nil && now.Sub(node.DeletionTimestamp.Time) > threshold {
+			stuck = 1
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: stuck,
+		})
+	}
+	return publishSeries(stuckTerminatingByNodeProvisioner, provisioner, series)
+}
+
+// publishNodeTaintCounts publishes the number of taints on each node.
+func publishNodeTaintCounts(provisioner string, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	for _, node := range nodes {
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: len(node.Spec.Taints),
+		})
+	}
+	return publishSeries(taintCountByNodeProvisioner, provisioner, series)
+}
+
+// publishMissingDaemons publishes a series for each daemonset that is expected
+// to run on a node but has no pod scheduled there. A daemonset is expected if
+// its pod template tolerates the node's scheduling taints and its node selector
+// matches the node's labels.
+func publishMissingDaemons(provisioner string, nodes []v1.Node, daemonSets []appsv1.DaemonSet, podList []v1.Pod) error {
+	scheduled := map[string]sets.String{}
+	for _, pod := range podList {
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			if _, ok := scheduled[pod.Spec.NodeName]; !ok {
+				scheduled[pod.Spec.NodeName] = sets.NewString()
+			}
+			scheduled[pod.Spec.NodeName].Insert(pod.Namespace + "/" + owner.Name)
+		}
+	}
+	series := []seriesCount{}
+	for _, node := range nodes {
+		for i := range daemonSets {
+			daemonSet := &daemonSets[i]
+			if !daemonExpectedOn(&node, daemonSet) || scheduled[node.Name].Has(daemonSet.Namespace+"/"+daemonSet.Name) {
+				continue
+			}
+			series = append(series, seriesCount{
+				labels: prometheus.Labels{
+					metricLabelNode:        node.Name,
+					metricLabelNamespace:   daemonSet.Namespace,
+					metricLabelDaemonSet:   daemonSet.Name,
+					metricLabelProvisioner: provisioner,
+				},
+				count: 1,
+			})
+		}
+	}
+	return publishSeries(missingDaemonsByNodeProvisioner, provisioner, series)
+}
+
+// daemonExpectedOn returns true if the daemonset's pods would schedule on the
+// node, considering its node selector, its required node affinity, and the
+// tolerations the daemonset controller adds to its pods.
+func daemonExpectedOn(node *v1.Node, daemonSet *appsv1.DaemonSet) bool {
+	spec := daemonSet.Spec.Template.Spec
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil && spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil &&
+		!nodeSelectorMatches(node, spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution) {
+		return false
+	}
+	taints := v1alpha5.Taints{}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == v1.TaintEffectNoSchedule || taint.Effect == v1.TaintEffectNoExecute {
+			taints = append(taints, taint)
+		}
+	}
+	spec.Tolerations = append(daemonTolerations(&spec), spec.Tolerations...)
+	return taints.Tolerates(&v1.Pod{Spec: spec}) == nil
+}
+
+// daemonTolerations returns the tolerations the daemonset controller adds to
+// the pods of a daemonset.
+func daemonTolerations(spec *v1.PodSpec) []v1.Toleration {
+	tolerations := []v1.Toleration{
+		{Key: v1.TaintNodeNotReady, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+		{Key: v1.TaintNodeUnreachable, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute},
+		{Key: v1.TaintNodeDiskPressure, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+		{Key: v1.TaintNodeMemoryPressure, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+		{Key: v1.TaintNodePIDPressure, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+		{Key: v1.TaintNodeUnschedulable, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+	}
+	if spec.HostNetwork {
+		tolerations = append(tolerations, v1.Toleration{Key: v1.TaintNodeNetworkUnavailable, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule})
+	}
+	return tolerations
+}
+
+// nodeSelectorMatches returns true if the node matches any of the selector's
+// terms. A term matches if all of its expressions and fields match.
+func nodeSelectorMatches(node *v1.Node, selector *v1.NodeSelector) bool {
+	for _, term := range selector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if nodeSelectorRequirementsMatch(term.MatchExpressions, labels.Set(node.Labels)) &&
+			nodeSelectorRequirementsMatch(term.MatchFields, labels.Set{metav1.ObjectNameField: node.Name}) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeSelectorOperators maps node selector operators to their label selector
+// equivalents.
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+func nodeSelectorRequirementsMatch(nodeSelectorRequirements []v1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, nodeSelectorRequirement := range nodeSelectorRequirements {
+		requirement, err := labels.NewRequirement(nodeSelectorRequirement.Key, nodeSelectorOperators[nodeSelectorRequirement.Operator], nodeSelectorRequirement.Values)
+		if err != nil || !requirement.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// publishNodeGenerationCounts publishes the count of nodes per provisioner
+// generation, read from the label set on nodes at creation. Nodes created
+// before the label was introduced have an empty generation. If disabled, no
+// series are published.
+func publishNodeGenerationCounts(enabled bool, provisioner string, nodes []v1.Node) error {
+	countByGeneration := map[string]int{}
+	if enabled {
+		for _, node := range nodes {
+			countByGeneration[node.Labels[v1alpha5.ProvisionerGenerationLabelKey]]++
+		}
+	}
+	series := make([]seriesCount, 0, len(countByGeneration))
+	for generation, count := range countByGeneration {
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelProvisioner:           provisioner,
+				metricLabelProvisionerGeneration: generation,
+			},
+			count: count,
+		})
+	}
+	return publishSeries(nodeCountByProvisionerGeneration, provisioner, series)
+}
+
+// publishNodeInstanceInfo publishes the instance ID of each node, which can be
+// joined with other node metrics on the node label. Nodes without a provider
+// ID are not published. If disabled, no series are published.
+func publishNodeInstanceInfo(enabled bool, provisioner string, nodes []v1.Node) error {
+	series := make([]seriesCount, 0, len(nodes))
+	if !enabled {
+		return publishSeries(instanceInfoByNodeProvisioner, provisioner, series)
+	}
+	for _, node := range nodes {
+		instanceID := instanceIDFromProviderID(node.Spec.ProviderID)
+		if instanceID == "" {
+			continue
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelInstanceID:  instanceID,
+				metricLabelNode:        node.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: 1,
+		})
+	}
+	return publishSeries(instanceInfoByNodeProvisioner, provisioner, series)
+}
+
+// instanceIDFromProviderID returns the last segment of a provider ID, e.g.
+// i-0abc123 for aws:///us-east-1a/i-0abc123.
+func instanceIDFromProviderID(providerID string) string {
+	return providerID[strings.LastIndex(providerID, "/")+1:]
+}
+
+// deleteNodeCounts deletes the node counts that are labeled only by provisioner.
+func deleteNodeCounts(provisioner string) {
+	metricLabels := prometheus.Labels{metricLabelProvisioner: provisioner}
+	nodeCountByProvisioner.Delete(metricLabels)
+	readyNodeCountByProvisioner.Delete(metricLabels)
+	unschedulableNodeCountByProvisioner.Delete(metricLabels)
+	deleteSeries(taintCountByNodeProvisioner, provisioner)
+	deleteSeries(missingDaemonsByNodeProvisioner, provisioner)
+	deleteSeries(nodeCountByProvisionerGeneration, provisioner)
+}
+
+// withoutExcludedNodes returns the nodes that are not annotated to be excluded
+// from metrics. Series for excluded nodes are deleted as they are no longer
+// published.
+func withoutExcludedNodes(nodes []v1.Node) []v1.Node {
+	included := make([]v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Annotations[v1alpha5.MetricsExcludeAnnotationKey] != "true" {
+			included = append(included, node)
+		}
+	}
+	return included
+}
+
 // filterReadyNodes returns a new function that will filter "ready" nodes to pass on
 // to `consume`, and returns the result.
 func filterReadyNodes(consume nodeListConsumerFunc) nodeListConsumerFunc {
@@ -168,7 +1010,7 @@ func filterReadyNodes(consume nodeListConsumerFunc) nodeListConsumerFunc {
 	}
 }
 
-func metricLabelsFrom(nodeLabels map[string]string) prometheus.Labels {
+func metricLabelsFrom(provisionerLabelKey string, nodeLabels map[string]string) prometheus.Labels {
 	metricLabels := prometheus.Labels{}
 	// Exclude node label values that not present or are empty strings.
 	if arch := nodeLabels[nodeLabelArch]; arch != "" {
@@ -177,7 +1019,7 @@ func metricLabelsFrom(nodeLabels map[string]string) prometheus.Labels {
 	if instanceType := nodeLabels[nodeLabelInstanceType]; instanceType != "" {
 		metricLabels[metricLabelInstanceType] = instanceType
 	}
-	if provisioner := nodeLabels[nodeLabelProvisioner]; provisioner != "" {
+	if provisioner := nodeLabels[provisionerLabelKey]; provisioner != "" {
 		metricLabels[metricLabelProvisioner] = provisioner
 	}
 	if zone := nodeLabels[nodeLabelZone]; zone != "" {
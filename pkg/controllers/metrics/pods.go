@@ -15,15 +15,32 @@ limitations under the License.
 package metrics
 
 import (
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/aws/karpenter/pkg/utils/node"
+	"github.com/aws/karpenter/pkg/utils/pod"
+	"github.com/aws/karpenter/pkg/utils/resources"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
+// pendingPodsNoProvisioner is the provisioner label value for pending pods that
+// do not select a provisioner.
+const pendingPodsNoProvisioner = "none"
+
+// podReasonEvicted is the status reason the kubelet sets on pods it evicts.
+const podReasonEvicted = "Evicted"
+
 var (
 	phaseValues = []v1.PodPhase{
 		v1.PodFailed,
@@ -45,10 +62,202 @@ var (
 			metricLabelProvisioner,
 		},
 	)
+
+	podRestartsByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "restarts",
+			Help:      "Total container restart count of pods by provisioner.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	podRestartsByNamespacePodProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "container_restarts",
+			Help:      "Total container restart count by pod and provisioner.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelPod,
+			metricLabelProvisioner,
+		},
+	)
+
+	podsMissingRequestsByNamespaceOwnerProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "missing_requests",
+			Help:      "Count of pods that request neither CPU nor memory by namespace, owner, and provisioner.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelOwner,
+			metricLabelOwnerKind,
+			metricLabelOwnerName,
+			metricLabelProvisioner,
+		},
+	)
+
+	podCountByNamespaceOwnerProvisionerZone = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "zone_distribution",
+			Help:      "Count of scheduled pods by namespace, owner, provisioner, and zone.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelOwner,
+			metricLabelOwnerKind,
+			metricLabelOwnerName,
+			metricLabelProvisioner,
+			metricLabelZone,
+		},
+	)
+
+	podCountByNamespaceOwnerPhaseProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Name:      "workload_pods",
+			Help:      "Count of pods by namespace, owner, phase, and provisioner.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelOwner,
+			metricLabelOwnerKind,
+			metricLabelOwnerName,
+			metricLabelPhase,
+			metricLabelProvisioner,
+		},
+	)
+
+	pendingPodCountByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Name:      "pending_pods",
+			Help:      "Count of pending pods by the provisioner they select, or none.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	evictedPodsCounterByProvisioner = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "evicted_total",
+			Help:      "Count of pods observed failed due to eviction by provisioner.",
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
+
+	podsWaitingForVolumeZoneByProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "waiting_for_volume_zone",
+			Help:      "Whether a pending pod with persistent volume claims requires zones without a ready node, by pod and provisioner.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelPod,
+			metricLabelProvisioner,
+		},
+	)
+
+	podRequestsByNamespaceResourceProvisioner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemNamespace,
+			Name:      "pod_requests",
+			Help:      "Sum of the resource requests of non-terminal pods, by namespace, resource type, and provisioner.",
+		},
+		[]string{
+			metricLabelNamespace,
+			metricLabelResourceType,
+			metricLabelProvisioner,
+		},
+	)
+
+	pendingDurationByProvisioner = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: metricSubsystemPods,
+			Name:      "pending_duration_seconds",
+			Help:      "Duration pods were pending, from creation until scheduled to a node, by provisioner.",
+			Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		},
+		[]string{
+			metricLabelProvisioner,
+		},
+	)
 )
 
+// observedEvictions records the evicted pods last observed by provisioner, so
+// each eviction is only counted once while the pod remains.
+var observedEvictions = struct {
+	sync.Mutex
+	pods map[string]sets.String
+}{pods: map[string]sets.String{}}
+
+// observedPendingPods records the pending pods last observed by provisioner, so
+// a pod's pending duration is only observed once it is seen to be scheduled.
+var observedPendingPods = struct {
+	sync.Mutex
+	pods map[string]sets.String
+}{pods: map[string]sets.String{}}
+
 func init() {
 	crmetrics.Registry.MustRegister(podCountByPhaseProvisioner)
+	crmetrics.Registry.MustRegister(podRestartsByProvisioner)
+	crmetrics.Registry.MustRegister(podRestartsByNamespacePodProvisioner)
+	crmetrics.Registry.MustRegister(podsMissingRequestsByNamespaceOwnerProvisioner)
+	crmetrics.Registry.MustRegister(podCountByNamespaceOwnerProvisionerZone)
+	crmetrics.Registry.MustRegister(podCountByNamespaceOwnerPhaseProvisioner)
+	crmetrics.Registry.MustRegister(evictedPodsCounterByProvisioner)
+	crmetrics.Registry.MustRegister(pendingDurationByProvisioner)
+	crmetrics.Registry.MustRegister(podRequestsByNamespaceResourceProvisioner)
+	crmetrics.Registry.MustRegister(pendingPodCountByProvisioner)
+	crmetrics.Registry.MustRegister(podsWaitingForVolumeZoneByProvisioner)
+}
+
+// selectNonTerminalPods returns the pods that are not Succeeded or Failed,
+// unless includeTerminal is true.
+func selectNonTerminalPods(includeTerminal bool, podList []v1.Pod) []v1.Pod {
+	if includeTerminal {
+		return podList
+	}
+	selected := make([]v1.Pod, 0, len(podList))
+	for i := range podList {
+		if !pod.IsTerminal(&podList[i]) {
+			selected = append(selected, podList[i])
+		}
+	}
+	return selected
+}
+
+// selectPods returns the pods matching the selector.
+func selectPods(selector labels.Selector, podList []v1.Pod) []v1.Pod {
+	if selector.Empty() {
+		return podList
+	}
+	selected := make([]v1.Pod, 0, len(podList))
+	for _, pod := range podList {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected
 }
 
 func publishPodCounts(provisioner string, podList []v1.Pod) error {
@@ -70,3 +279,360 @@ func publishPodCounts(provisioner string, podList []v1.Pod) error {
 
 	return multierr.Combine(errors...)
 }
+
+// publishNamespacePodRequests publishes the sum of the resource requests of the
+// non-terminal pods in each namespace. Series for namespaces or resources that
+// are no longer requested are deleted.
+func publishNamespacePodRequests(provisioner string, podList []v1.Pod) error {
+	requestsByNamespace := map[string]v1.ResourceList{}
+	for i := range podList {
+		if pod.IsTerminal(&podList[i]) {
+			continue
+		}
+		requests, _ := resources.PodResources(&podList[i])
+		requestsByNamespace[podList[i].Namespace] = resources.Merge(requestsByNamespace[podList[i].Namespace], requests)
+	}
+
+	series := []seriesValue{}
+	for namespace, requests := range requestsByNamespace {
+		for resourceName, quantity := range requests {
+			series = append(series, seriesValue{
+				labels: prometheus.Labels{
+					metricLabelNamespace:    namespace,
+					metricLabelResourceType: string(resourceName),
+					metricLabelProvisioner:  provisioner,
+				},
+				value: quantity.AsApproximateFloat64(),
+			})
+		}
+	}
+	return publishSeriesValues(podRequestsByNamespaceResourceProvisioner, provisioner, series)
+}
+
+func publishPodRestarts(provisioner string, podList []v1.Pod) error {
+	restarts := 0
+	for _, pod := range podList {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			restarts += int(containerStatus.RestartCount)
+		}
+	}
+	return publishCount(podRestartsByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner}, restarts)
+}
+
+// publishPodRestartsByPod publishes the total container restart count of each
+// pod. If disabled, no series are published.
+func publishPodRestartsByPod(enabled bool, provisioner string, podList []v1.Pod) error {
+	series := make([]seriesCount, 0, len(podList))
+	if !enabled {
+		return publishSeries(podRestartsByNamespacePodProvisioner, provisioner, series)
+	}
+	for _, pod := range podList {
+		restarts := 0
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			restarts += int(containerStatus.RestartCount)
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNamespace:   pod.Namespace,
+				metricLabelPod:         pod.Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: restarts,
+		})
+	}
+	return publishSeries(podRestartsByNamespacePodProvisioner, provisioner, series)
+}
+
+func publishPodsMissingRequests(provisioner string, podList []v1.Pod) error {
+	countByOwner := map[podOwner]int{}
+	for i := range podList {
+		if pod.IsTerminal(&podList[i]) {
+			continue
+		}
+		requests, _ := resources.PodResources(&podList[i])
+		_, hasCPU := requests[v1.ResourceCPU]
+		_, hasMemory := requests[v1.ResourceMemory]
+		if hasCPU || hasMemory {
+			continue
+		}
+		countByOwner[ownerOf(&podList[i])]++
+	}
+
+	series := make([]seriesCount, 0, len(countByOwner))
+	for owner, count := range countByOwner {
+		metricLabels := owner.labels()
+		metricLabels[metricLabelProvisioner] = provisioner
+		series = append(series, seriesCount{labels: metricLabels, count: count})
+	}
+	return publishSeries(podsMissingRequestsByNamespaceOwnerProvisioner, provisioner, series)
+}
+
+// publishPodZoneDistribution publishes the count of pods per owner in each zone,
+// where a pod's zone is the zone of the node it is scheduled to. Pods that are
+// not yet scheduled, or whose node has no zone label, are not counted.
+func publishPodZoneDistribution(provisioner string, podList []v1.Pod, nodes []v1.Node) error {
+	zoneForNode := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		zoneForNode[node.Name] = node.Labels[nodeLabelZone]
+	}
+
+	type ownerZone struct {
+		owner podOwner
+		zone  string
+	}
+	countByOwnerZone := map[ownerZone]int{}
+	for i := range podList {
+		zone := zoneForNode[podList[i].Spec.NodeName]
+		if zone == "" {
+			continue
+		}
+		countByOwnerZone[ownerZone{owner: ownerOf(&podList[i]), zone: zone}]++
+	}
+
+	series := make([]seriesCount, 0, len(countByOwnerZone))
+	for key, count := range countByOwnerZone {
+		metricLabels := key.owner.labels()
+		metricLabels[metricLabelProvisioner] = provisioner
+		metricLabels[metricLabelZone] = key.zone
+		series = append(series, seriesCount{labels: metricLabels, count: count})
+	}
+	return publishSeries(podCountByNamespaceOwnerProvisionerZone, provisioner, series)
+}
+
+// publishWorkloadPodCounts publishes the count of pods per owner in each phase.
+// Series for owners or phases without pods are deleted.
+func publishWorkloadPodCounts(provisioner string, podList []v1.Pod) error {
+	type ownerPhase struct {
+		owner podOwner
+		phase v1.PodPhase
+	}
+	countByOwnerPhase := map[ownerPhase]int{}
+	for i := range podList {
+		countByOwnerPhase[ownerPhase{owner: ownerOf(&podList[i]), phase: podList[i].Status.Phase}]++
+	}
+
+	series := make([]seriesCount, 0, len(countByOwnerPhase))
+	for key, count := range countByOwnerPhase {
+		metricLabels := key.owner.labels()
+		metricLabels[metricLabelPhase] = strings.ToLower(string(key.phase))
+		metricLabels[metricLabelProvisioner] = provisioner
+		series = append(series, seriesCount{labels: metricLabels, count: count})
+	}
+	return publishSeries(podCountByNamespaceOwnerPhaseProvisioner, provisioner, series)
+}
+
+// publishPendingPodCounts publishes the count of pending pods that select the
+// provisioner, and of those that select no provisioner at all. A pod selects a
+// provisioner through its node selector or required node affinity on the
+// provisioner label key.
+func publishPendingPodCounts(provisionerLabelKey string, provisioner string, podList []v1.Pod) error {
+	selecting, selectingNone := 0, 0
+	for i := range podList {
+		if pod.IsScheduled(&podList[i]) || podList[i].Status.Phase != v1.PodPending {
+			continue
+		}
+		selected := selectedProvisioners(provisionerLabelKey, &podList[i])
+		if selected.Has(provisioner) {
+			selecting++
+		}
+		if selected.Len() == 0 {
+			selectingNone++
+		}
+	}
+	// The series for pods that select no provisioner is published while any
+	// exist, and is deleted once there are none.
+	none := []seriesCount{}
+	if selectingNone > 0 {
+		none = append(none, seriesCount{labels: prometheus.Labels{metricLabelProvisioner: pendingPodsNoProvisioner}, count: selectingNone})
+	}
+	return multierr.Combine(
+		publishCount(pendingPodCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner}, selecting),
+		publishSeries(pendingPodCountByProvisioner, pendingPodsNoProvisioner, none),
+	)
+}
+
+// publishPodsWaitingForVolumeZone publishes a series for each pending pod that
+// selects the provisioner, mounts a persistent volume claim, and requires zones
+// in which no node is ready.
+func publishPodsWaitingForVolumeZone(provisionerLabelKey string, provisioner string, podList []v1.Pod, nodes []v1.Node) error {
+	readyZones := sets.NewString()
+	for i := range nodes {
+		if node.IsReady(&nodes[i]) {
+			readyZones.Insert(nodes[i].Labels[nodeLabelZone])
+		}
+	}
+	series := []seriesCount{}
+	for i := range podList {
+		if pod.IsScheduled(&podList[i]) || podList[i].Status.Phase != v1.PodPending || !hasPersistentVolumeClaim(&podList[i]) {
+			continue
+		}
+		if !selectedProvisioners(provisionerLabelKey, &podList[i]).Has(provisioner) {
+			continue
+		}
+		zones := v1alpha5.PodRequirements(&podList[i]).Zones()
+		if zones == nil || zones.HasAny(readyZones.UnsortedList()...) {
+			continue
+		}
+		series = append(series, seriesCount{
+			labels: prometheus.Labels{
+				metricLabelNamespace:   podList[i].Namespace,
+				metricLabelPod:         podList[i].Name,
+				metricLabelProvisioner: provisioner,
+			},
+			count: 1,
+		})
+	}
+	return publishSeries(podsWaitingForVolumeZoneByProvisioner, provisioner, series)
+}
+
+func hasPersistentVolumeClaim(p *v1.Pod) bool {
+	for _, volume := range p.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedProvisioners returns the provisioners a pod selects with its node
+// selector or the In requirements of its required node affinity.
+func selectedProvisioners(provisionerLabelKey string, p *v1.Pod) sets.String {
+	selected := sets.NewString()
+	if provisioner, ok := p.Spec.NodeSelector[provisionerLabelKey]; ok {
+		selected.Insert(provisioner)
+	}
+	if p.Spec.Affinity == nil || p.Spec.Affinity.NodeAffinity == nil || p.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return selected
+	}
+	for _, term := range p.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, requirement := range term.MatchExpressions {
+			if requirement.Key == provisionerLabelKey && requirement.Operator == v1.NodeSelectorOpIn {
+				selected.Insert(requirement.Values...)
+			}
+		}
+	}
+	return selected
+}
+
+// deletePendingPodCount deletes the pending pod count of the provisioner, and
+// the count of pods that select no provisioner, which is republished by any
+// remaining provisioner.
+func deletePendingPodCount(provisioner string) {
+	pendingPodCountByProvisioner.Delete(prometheus.Labels{metricLabelProvisioner: provisioner})
+	deleteSeries(pendingPodCountByProvisioner, pendingPodsNoProvisioner)
+}
+
+// countEvictedPods increments the evicted pods counter for each failed pod with
+// the Evicted reason that was not observed on the previous call.
+func countEvictedPods(provisioner string, podList []v1.Pod) error {
+	observedEvictions.Lock()
+	defer observedEvictions.Unlock()
+
+	counter, err := evictedPodsCounterByProvisioner.GetMetricWith(prometheus.Labels{metricLabelProvisioner: provisioner})
+	if err != nil {
+		return err
+	}
+	evicted := sets.NewString()
+	for i := range podList {
+		if podList[i].Status.Phase != v1.PodFailed || podList[i].Status.Reason != podReasonEvicted {
+			continue
+		}
+		uid := string(podList[i].UID)
+		evicted.Insert(uid)
+		if !observedEvictions.pods[provisioner].Has(uid) {
+			counter.Inc()
+		}
+	}
+	observedEvictions.pods[provisioner] = evicted
+	return nil
+}
+
+func deleteEvictedPodCount(provisioner string) {
+	observedEvictions.Lock()
+	defer observedEvictions.Unlock()
+
+	evictedPodsCounterByProvisioner.Delete(prometheus.Labels{metricLabelProvisioner: provisioner})
+	delete(observedEvictions.pods, provisioner)
+}
+
+// observePendingDurations observes the pending duration of each pod that was
+// pending on the previous call and is now scheduled, so pods that were already
+// scheduled when first seen are never observed. The duration is measured from
+// the pod's creation to its PodScheduled condition, and pods whose condition has
+// no transition time are not observed.
+func observePendingDurations(provisioner string, podList []v1.Pod) error {
+	observedPendingPods.Lock()
+	defer observedPendingPods.Unlock()
+
+	observer, err := pendingDurationByProvisioner.GetMetricWith(prometheus.Labels{metricLabelProvisioner: provisioner})
+	if err != nil {
+		return err
+	}
+	pending := sets.NewString()
+	for i := range podList {
+		uid := string(podList[i].UID)
+		if podList[i].Spec.NodeName == "" {
+			pending.Insert(uid)
+			continue
+		}
+		if !observedPendingPods.pods[provisioner].Has(uid) {
+			continue
+		}
+		if scheduled, ok := scheduledAt(&podList[i]); ok {
+			observer.Observe(scheduled.Sub(podList[i].CreationTimestamp.Time).Seconds())
+		}
+	}
+	observedPendingPods.pods[provisioner] = pending
+	return nil
+}
+
+// scheduledAt returns the time the pod was scheduled, and false if unknown.
+func scheduledAt(pod *v1.Pod) (time.Time, bool) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func deletePendingDurations(provisioner string) {
+	observedPendingPods.Lock()
+	defer observedPendingPods.Unlock()
+
+	pendingDurationByProvisioner.Delete(prometheus.Labels{metricLabelProvisioner: provisioner})
+	delete(observedPendingPods.pods, provisioner)
+}
+
+// podOwner identifies the controller of a pod within its namespace.
+type podOwner struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+// ownerOf returns the pod's namespace and the kind and name of its controller.
+// Pods without a controller have an empty owner kind and name.
+func ownerOf(pod *v1.Pod) podOwner {
+	owner := podOwner{namespace: pod.Namespace}
+	if controller := metav1.GetControllerOf(pod); controller != nil {
+		owner.kind = controller.Kind
+		owner.name = controller.Name
+	}
+	return owner
+}
+
+// labels returns the metric labels identifying the owner. The owner label joins
+// the kind and name, and is kept alongside the separate labels for compatibility.
+func (o podOwner) labels() prometheus.Labels {
+	owner := ""
+	if o.kind != "" {
+		owner = fmt.Sprintf("%s/%s", o.kind, o.name)
+	}
+	return prometheus.Labels{
+		metricLabelNamespace: o.namespace,
+		metricLabelOwner:     owner,
+		metricLabelOwnerKind: o.kind,
+		metricLabelOwnerName: o.name,
+	}
+}
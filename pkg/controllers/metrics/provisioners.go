@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var provisionerCount = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "provisioners",
+		Help:      "Count of provisioners.",
+	},
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(provisionerCount)
+}
+
+// observedProvisioners records the provisioners that exist as of their last
+// reconcile, so repeated reconciles of a provisioner are only counted once.
+var observedProvisioners = struct {
+	sync.Mutex
+	names sets.String
+}{names: sets.NewString()}
+
+func observeProvisioner(name string) {
+	observedProvisioners.Lock()
+	defer observedProvisioners.Unlock()
+	observedProvisioners.names.Insert(name)
+	provisionerCount.Set(float64(observedProvisioners.names.Len()))
+}
+
+func forgetProvisioner(name string) {
+	observedProvisioners.Lock()
+	defer observedProvisioners.Unlock()
+	observedProvisioners.names.Delete(name)
+	provisionerCount.Set(float64(observedProvisioners.names.Len()))
+}
@@ -0,0 +1,993 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pallinder/go-randomdata"
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"github.com/aws/karpenter/pkg/cloudprovider/fake"
+	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"knative.dev/pkg/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics")
+}
+
+var _ = Describe("Metrics", func() {
+	var provisioner string
+
+	BeforeEach(func() {
+		provisioner = strings.ToLower(randomdata.SillyName())
+	})
+
+	Context("Controller", func() {
+		It("should read the time from its clock", func() {
+			now := time.Now()
+			fakeClock := clock.NewFakeClock(now)
+			node := test.Node(test.NodeOptions{
+				Name:        "not-ready-node",
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner},
+				ReadyStatus: v1.ConditionFalse,
+			})
+			node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-time.Minute))
+			controller := &Controller{
+				CloudProvider: &fake.CloudProvider{},
+				KubeClient:    newKubeClient(node),
+				Clock:         fakeClock,
+			}
+			metricLabels := prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner}
+			ctx := injection.WithOptions(context.Background(), options.Options{})
+
+			Expect(controller.updateNodeCounts(ctx, &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}})).To(Succeed())
+			Expect(gaugeValue(notReadySecondsByNodeProvisioner, metricLabels)).To(BeNumerically("==", 60))
+
+			fakeClock.Step(time.Minute)
+			Expect(controller.updateNodeCounts(ctx, &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}})).To(Succeed())
+			Expect(gaugeValue(notReadySecondsByNodeProvisioner, metricLabels)).To(BeNumerically("==", 120))
+		})
+		It("should delete series for nodes excluded from metrics", func() {
+			node := test.Node(test.NodeOptions{
+				Name:        "excluded-node",
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner},
+				ReadyStatus: v1.ConditionFalse,
+			})
+			kubeClient := newKubeClient(node)
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			ctx := injection.WithOptions(context.Background(), options.Options{})
+			p := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
+
+			Expect(controller.updateNodeCounts(ctx, p)).To(Succeed())
+			Expect(controller.updateNodeInterruptions(ctx, p)).To(Succeed())
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(HaveLen(1))
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(HaveLen(1))
+
+			node.Annotations[v1alpha5.MetricsExcludeAnnotationKey] = "true"
+			Expect(kubeClient.Update(ctx, node)).To(Succeed())
+			Expect(controller.updateNodeCounts(ctx, p)).To(Succeed())
+			Expect(controller.updateNodeInterruptions(ctx, p)).To(Succeed())
+			Expect(gaugeValue(nodeCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})).To(BeNumerically("==", 0))
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(interruptionByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should count provisioners as they are created and deleted", func() {
+			kubeClient := newKubeClient()
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			ctx := injection.WithOptions(context.Background(), options.Options{})
+			first := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
+			second := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner + "-second"}}
+			reconcileProvisioner := func(p *v1alpha5.Provisioner) error {
+				_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)})
+				return err
+			}
+			existing := testutil.ToFloat64(provisionerCount)
+
+			Expect(kubeClient.Create(ctx, first)).To(Succeed())
+			Expect(kubeClient.Create(ctx, second)).To(Succeed())
+			Expect(reconcileProvisioner(first)).To(Succeed())
+			Expect(reconcileProvisioner(first)).To(Succeed())
+			Expect(reconcileProvisioner(second)).To(Succeed())
+			Expect(testutil.ToFloat64(provisionerCount)).To(Equal(existing + 2))
+
+			Expect(kubeClient.Delete(ctx, first)).To(Succeed())
+			Expect(reconcileProvisioner(first)).To(Succeed())
+			Expect(testutil.ToFloat64(provisionerCount)).To(Equal(existing + 1))
+
+			Expect(kubeClient.Delete(ctx, second)).To(Succeed())
+			Expect(reconcileProvisioner(second)).To(Succeed())
+			Expect(testutil.ToFloat64(provisionerCount)).To(Equal(existing))
+		})
+		It("should count provisioners outside of the allowlist or awaiting node labels", func() {
+			node := test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner + "-unlabeled"}})
+			filtered := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner + "-filtered"}}
+			unlabeled := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner + "-unlabeled"}}
+			kubeClient := newKubeClient(filtered, unlabeled, node)
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			ctx := injection.WithOptions(context.Background(), options.Options{MetricsProvisionerAllowlist: unlabeled.Name, MetricsRequireNodeLabels: true})
+			reconcileProvisioner := func(p *v1alpha5.Provisioner) (reconcile.Result, error) {
+				return controller.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)})
+			}
+			existing := testutil.ToFloat64(provisionerCount)
+
+			_, err := reconcileProvisioner(filtered)
+			Expect(err).ToNot(HaveOccurred())
+			result, err := reconcileProvisioner(unlabeled)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(incompleteNodeLabelsRequeueAfter))
+			Expect(testutil.ToFloat64(provisionerCount)).To(Equal(existing + 2))
+
+			Expect(kubeClient.Delete(ctx, filtered)).To(Succeed())
+			Expect(kubeClient.Delete(ctx, unlabeled)).To(Succeed())
+			_, err = reconcileProvisioner(filtered)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = reconcileProvisioner(unlabeled)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testutil.ToFloat64(provisionerCount)).To(Equal(existing))
+		})
+		It("should delete series for provisioners outside of the allowlist", func() {
+			node := test.Node(test.NodeOptions{
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner},
+				ReadyStatus: v1.ConditionFalse,
+			})
+			p := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
+			kubeClient := newKubeClient(p, node)
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			reconcileWith := func(allowlist string) error {
+				ctx := injection.WithOptions(context.Background(), options.Options{MetricsProvisionerAllowlist: allowlist})
+				_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)})
+				return err
+			}
+
+			Expect(reconcileWith(provisioner)).To(Succeed())
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(HaveLen(1))
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(HaveLen(1))
+
+			Expect(reconcileWith("another-provisioner")).To(Succeed())
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(podCountByNamespaceOwnerPhaseProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should relabel pod series when a pod is rescheduled to another node", func() {
+			nodeA := test.Node(test.NodeOptions{Name: "node-a", Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner, nodeLabelZone: "test-zone-a"}})
+			nodeB := test.Node(test.NodeOptions{Name: "node-b", Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner, nodeLabelZone: "test-zone-b"}})
+			pod := test.Pod(test.PodOptions{Name: "rescheduled-pod", NodeName: nodeA.Name, Phase: v1.PodRunning})
+			kubeClient := newKubeClient(nodeA, nodeB, pod)
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			ctx := injection.WithOptions(context.Background(), options.Options{})
+			p := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
+			zonesFor := func() (zones []string) {
+				for _, series := range seriesFor(podCountByNamespaceOwnerProvisionerZone, provisioner) {
+					zones = append(zones, series[metricLabelZone])
+				}
+				return zones
+			}
+
+			Expect(controller.updatePodCounts(ctx, p)).To(Succeed())
+			Expect(zonesFor()).To(ConsistOf("test-zone-a"))
+
+			// Pods are rescheduled by recreating them on another node
+			Expect(kubeClient.Delete(ctx, pod)).To(Succeed())
+			rescheduled := test.Pod(test.PodOptions{Name: pod.Name, NodeName: nodeB.Name, Phase: v1.PodRunning})
+			Expect(kubeClient.Create(ctx, rescheduled)).To(Succeed())
+			Expect(controller.updatePodCounts(ctx, p)).To(Succeed())
+			Expect(zonesFor()).To(ConsistOf("test-zone-b"))
+		})
+		It("should requeue without publishing until nodes are labeled when required", func() {
+			node := test.Node(test.NodeOptions{Labels: map[string]string{
+				v1alpha5.ProvisionerNameLabelKey: provisioner,
+				nodeLabelArch:                    "amd64",
+				nodeLabelInstanceType:            "test-instance-type",
+			}})
+			p := &v1alpha5.Provisioner{ObjectMeta: metav1.ObjectMeta{Name: provisioner}}
+			kubeClient := newKubeClient(p, node)
+			controller := &Controller{CloudProvider: &fake.CloudProvider{}, KubeClient: kubeClient, Clock: clock.RealClock{}}
+			ctx := injection.WithOptions(context.Background(), options.Options{MetricsRequireNodeLabels: true})
+
+			result, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(incompleteNodeLabelsRequeueAfter))
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(BeEmpty())
+
+			node.Labels[nodeLabelZone] = "test-zone-1"
+			Expect(kubeClient.Update(ctx, node)).To(Succeed())
+			result, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).ToNot(Equal(incompleteNodeLabelsRequeueAfter))
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(HaveLen(1))
+		})
+		It("should configure the reconcile concurrency from options", func() {
+			ctx := injection.WithOptions(context.Background(), options.Options{MetricsReconcileConcurrency: 42})
+			Expect(controllerOptions(ctx).MaxConcurrentReconciles).To(Equal(42))
+		})
+		It("should configure the rate limiter from options", func() {
+			ctx := injection.WithOptions(context.Background(), options.Options{ReconcileBaseDelay: time.Second, ReconcileMaxDelay: time.Minute})
+			Expect(controllerOptions(ctx).RateLimiter.When("item")).To(Equal(time.Second))
+		})
+	})
+
+	Context("Nodes", func() {
+		It("should select nodes by a custom provisioner label key", func() {
+			customLabelKey := "example.com/provisioner-name"
+			knownValues := map[string]sets.String{
+				nodeLabelArch:         sets.NewString(),
+				nodeLabelInstanceType: sets.NewString(),
+				nodeLabelZone:         sets.NewString("test-zone-1"),
+			}
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Labels: map[string]string{customLabelKey: provisioner, nodeLabelZone: "test-zone-1"}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{customLabelKey: provisioner, nodeLabelZone: "test-zone-1"}}),
+			}
+			Expect(publishNodeCounts(customLabelKey, provisioner, time.Now(), knownValues, consumeNodesFrom(nodes))).To(Succeed())
+			Expect(gaugeValue(nodeCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})).To(BeNumerically("==", 2))
+			Expect(gaugeValue(readyNodeCountByProvisionerZone, prometheus.Labels{
+				metricLabelProvisioner: provisioner,
+				metricLabelZone:        "test-zone-1",
+			})).To(BeNumerically("==", 2))
+		})
+		It("should publish ready and total node counts by provisioner", func() {
+			knownValues := map[string]sets.String{}
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}, ReadyStatus: v1.ConditionFalse}),
+			}
+			metricLabels := prometheus.Labels{metricLabelProvisioner: provisioner}
+
+			Expect(publishNodeCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, time.Now(), knownValues, consumeNodesFrom(nodes))).To(Succeed())
+			Expect(gaugeValue(readyNodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 2))
+			Expect(gaugeValue(nodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 3))
+
+			deleteNodeCounts(provisioner)
+			Expect(seriesFor(readyNodeCountByProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(nodeCountByProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should retain node counts when listing nodes fails", func() {
+			knownValues := map[string]sets.String{}
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}, ReadyStatus: v1.ConditionFalse}),
+			}
+			metricLabels := prometheus.Labels{metricLabelProvisioner: provisioner}
+			Expect(publishNodeCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, time.Now(), knownValues, consumeNodesFrom(nodes))).To(Succeed())
+
+			failingList := func(client.MatchingLabels, nodeListConsumerFunc) error { return fmt.Errorf("failed to list nodes") }
+			Expect(publishNodeCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, time.Now(), knownValues, failingList)).ToNot(Succeed())
+			Expect(gaugeValue(readyNodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 1))
+			Expect(gaugeValue(nodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 2))
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(HaveLen(1))
+		})
+		It("should publish the count of cordoned nodes", func() {
+			node := test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}})
+			metricLabels := prometheus.Labels{metricLabelProvisioner: provisioner}
+
+			node.Spec.Unschedulable = true
+			Expect(publishProvisionerNodeCounts(metricLabels, []v1.Node{*node})).To(Succeed())
+			Expect(gaugeValue(unschedulableNodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 1))
+
+			node.Spec.Unschedulable = false
+			Expect(publishProvisionerNodeCounts(metricLabels, []v1.Node{*node})).To(Succeed())
+			Expect(gaugeValue(unschedulableNodeCountByProvisioner, metricLabels)).To(BeNumerically("==", 0))
+		})
+		It("should publish how long nodes have not been ready", func() {
+			now := time.Now()
+			node := test.Node(test.NodeOptions{Name: "not-ready-node", ReadyStatus: v1.ConditionFalse})
+			node.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-3 * time.Minute))
+			metricLabels := prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner}
+
+			Expect(publishNotReadySeconds(provisioner, now, []v1.Node{*node})).To(Succeed())
+			Expect(gaugeValue(notReadySecondsByNodeProvisioner, metricLabels)).To(BeNumerically("==", 180))
+
+			node.Status.Conditions[0].Status = v1.ConditionTrue
+			Expect(publishNotReadySeconds(provisioner, now, []v1.Node{*node})).To(Succeed())
+			Expect(seriesFor(notReadySecondsByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish the ephemeral storage headroom of nodes", func() {
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-a", Allocatable: v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse("10Gi")}}),
+				*test.Node(test.NodeOptions{Name: "node-b", Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}),
+			}
+			requests := v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceEphemeralStorage: resource.MustParse("3Gi")}}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{NodeName: "node-a", ResourceRequirements: requests}),
+				*test.Pod(test.PodOptions{NodeName: "node-a", ResourceRequirements: requests}),
+				*test.Pod(test.PodOptions{NodeName: "node-b", ResourceRequirements: requests}),
+			}
+			metricLabels := prometheus.Labels{metricLabelNode: "node-a", metricLabelProvisioner: provisioner}
+
+			Expect(publishEphemeralStorageHeadroom(provisioner, nodes, pods)).To(Succeed())
+			Expect(seriesFor(ephemeralStorageHeadroomByNodeProvisioner, provisioner)).To(ConsistOf(metricLabels))
+			Expect(gaugeValue(ephemeralStorageHeadroomByNodeProvisioner, metricLabels)).To(BeNumerically("==", 4*1024*1024*1024))
+		})
+		It("should publish the pods headroom of nodes", func() {
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-a", Allocatable: v1.ResourceList{v1.ResourcePods: resource.MustParse("58")}}),
+				*test.Node(test.NodeOptions{Name: "node-b", Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}),
+			}
+			pods := []v1.Pod{}
+			for i := 0; i < 30; i++ {
+				pods = append(pods, *test.Pod(test.PodOptions{NodeName: "node-a", Phase: v1.PodRunning}))
+			}
+			pods = append(pods, *test.Pod(test.PodOptions{NodeName: "node-a", Phase: v1.PodSucceeded}))
+			metricLabels := prometheus.Labels{metricLabelNode: "node-a", metricLabelProvisioner: provisioner}
+
+			Expect(publishPodsHeadroom(provisioner, nodes, pods)).To(Succeed())
+			Expect(seriesFor(podsHeadroomByNodeProvisioner, provisioner)).To(ConsistOf(metricLabels))
+			Expect(gaugeValue(podsHeadroomByNodeProvisioner, metricLabels)).To(BeNumerically("==", 28))
+		})
+		It("should publish the average pod density of each instance type", func() {
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-a", Labels: map[string]string{nodeLabelInstanceType: "m5.large"}}),
+				*test.Node(test.NodeOptions{Name: "node-b", Labels: map[string]string{nodeLabelInstanceType: "m5.large"}}),
+				*test.Node(test.NodeOptions{Name: "node-c"}),
+			}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{NodeName: "node-a", Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{NodeName: "node-b", Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{NodeName: "node-b", Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{NodeName: "node-b", Phase: v1.PodSucceeded}),
+				*test.Pod(test.PodOptions{NodeName: "node-c", Phase: v1.PodRunning}),
+			}
+			metricLabels := prometheus.Labels{metricLabelInstanceType: "m5.large", metricLabelProvisioner: provisioner}
+
+			Expect(publishPodDensity(provisioner, nodes, pods)).To(Succeed())
+			Expect(seriesFor(podDensityByInstancetypeProvisioner, provisioner)).To(ConsistOf(metricLabels))
+			Expect(gaugeValue(podDensityByInstancetypeProvisioner, metricLabels)).To(BeNumerically("==", 1.5))
+		})
+		It("should publish the utilization summed across nodes of all provisioners", func() {
+			other := provisioner + "-other"
+			defer func() {
+				Expect(deleteClusterUtilization(provisioner)).To(Succeed())
+				Expect(deleteClusterUtilization(other)).To(Succeed())
+			}()
+			allocatable := v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), v1.ResourceMemory: resource.MustParse("8Gi")}
+			requesting := func(nodeName string, cpu string, memory string) v1.Pod {
+				return *test.Pod(test.PodOptions{NodeName: nodeName, ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)},
+				}})
+			}
+			cpuLabels := prometheus.Labels{metricLabelResource: "cpu"}
+			memoryLabels := prometheus.Labels{metricLabelResource: "memory"}
+
+			Expect(publishClusterUtilization(provisioner, []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-a", Allocatable: allocatable}),
+				*test.Node(test.NodeOptions{Name: "node-b", Allocatable: allocatable}),
+			}, []v1.Pod{requesting("node-a", "2", "2Gi"), requesting("node-b", "1", "2Gi")})).To(Succeed())
+			Expect(gaugeValue(clusterUtilizationByResource, cpuLabels)).To(BeNumerically("==", 3.0/8))
+			Expect(gaugeValue(clusterUtilizationByResource, memoryLabels)).To(BeNumerically("==", 4.0/16))
+
+			Expect(publishClusterUtilization(other, []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-c", Allocatable: allocatable}),
+			}, []v1.Pod{requesting("node-c", "4", "8Gi")})).To(Succeed())
+			Expect(gaugeValue(clusterUtilizationByResource, cpuLabels)).To(BeNumerically("==", 7.0/12))
+			Expect(gaugeValue(clusterUtilizationByResource, memoryLabels)).To(BeNumerically("==", 12.0/24))
+
+			Expect(deleteClusterUtilization(other)).To(Succeed())
+			Expect(gaugeValue(clusterUtilizationByResource, cpuLabels)).To(BeNumerically("==", 3.0/8))
+
+			Expect(deleteClusterUtilization(provisioner)).To(Succeed())
+			Expect(testutil.CollectAndCount(clusterUtilizationByResource)).To(BeZero())
+		})
+		It("should publish the distinct zones of ready nodes by provisioner and across provisioners", func() {
+			other := provisioner + "-other"
+			existing := testutil.ToFloat64(nodeZoneCount)
+			nodeInZone := func(zone string, ready v1.ConditionStatus) v1.Node {
+				return *test.Node(test.NodeOptions{Labels: map[string]string{nodeLabelZone: provisioner + "-" + zone}, ReadyStatus: ready})
+			}
+			zoneCountOf := func(provisioner string) float64 {
+				return gaugeValue(zoneCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})
+			}
+
+			Expect(publishZoneCounts(provisioner, []v1.Node{
+				nodeInZone("zone-1", v1.ConditionTrue),
+				nodeInZone("zone-1", v1.ConditionTrue),
+				nodeInZone("zone-2", v1.ConditionTrue),
+				nodeInZone("zone-3", v1.ConditionFalse),
+			})).To(Succeed())
+			Expect(zoneCountOf(provisioner)).To(BeNumerically("==", 2))
+			Expect(testutil.ToFloat64(nodeZoneCount)).To(Equal(existing + 2))
+
+			Expect(publishZoneCounts(other, []v1.Node{
+				nodeInZone("zone-2", v1.ConditionTrue),
+				nodeInZone("zone-3", v1.ConditionTrue),
+				nodeInZone("zone-4", v1.ConditionTrue),
+			})).To(Succeed())
+			Expect(zoneCountOf(other)).To(BeNumerically("==", 3))
+			Expect(testutil.ToFloat64(nodeZoneCount)).To(Equal(existing + 4))
+
+			deleteZoneCounts(other)
+			Expect(seriesFor(zoneCountByProvisioner, other)).To(BeEmpty())
+			Expect(testutil.ToFloat64(nodeZoneCount)).To(Equal(existing + 2))
+
+			deleteZoneCounts(provisioner)
+			Expect(testutil.ToFloat64(nodeZoneCount)).To(Equal(existing))
+		})
+		It("should publish nodes under the utilization threshold as consolidation candidates", func() {
+			allocatable := v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), v1.ResourceMemory: resource.MustParse("8Gi")}
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Name: "underutilized-node", Allocatable: allocatable}),
+				*test.Node(test.NodeOptions{Name: "utilized-node", Allocatable: allocatable}),
+			}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{NodeName: "underutilized-node", ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+				}}),
+				*test.Pod(test.PodOptions{NodeName: "utilized-node", ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("6Gi")},
+				}}),
+			}
+
+			Expect(publishConsolidationCandidates(0.5, provisioner, nodes, pods)).To(Succeed())
+			Expect(gaugeValue(consolidationCandidateByNodeProvisioner, prometheus.Labels{metricLabelNode: "underutilized-node", metricLabelProvisioner: provisioner})).To(BeNumerically("==", 1))
+			Expect(gaugeValue(consolidationCandidateByNodeProvisioner, prometheus.Labels{metricLabelNode: "utilized-node", metricLabelProvisioner: provisioner})).To(BeNumerically("==", 0))
+
+			Expect(publishConsolidationCandidates(0, provisioner, nodes, pods)).To(Succeed())
+			Expect(seriesFor(consolidationCandidateByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should parse instance IDs from provider IDs", func() {
+			Expect(instanceIDFromProviderID("aws:///us-east-1a/i-0abc123")).To(Equal("i-0abc123"))
+			Expect(instanceIDFromProviderID("i-0abc123")).To(Equal("i-0abc123"))
+			Expect(instanceIDFromProviderID("")).To(BeEmpty())
+		})
+		It("should publish the instance ID of nodes", func() {
+			withProviderID := test.Node(test.NodeOptions{Name: "node-with-provider-id"})
+			withProviderID.Spec.ProviderID = "aws:///us-east-1a/i-0abc123"
+			withoutProviderID := test.Node(test.NodeOptions{Name: "node-without-provider-id"})
+
+			Expect(publishNodeInstanceInfo(true, provisioner, []v1.Node{*withProviderID, *withoutProviderID})).To(Succeed())
+			Expect(seriesFor(instanceInfoByNodeProvisioner, provisioner)).To(ConsistOf(prometheus.Labels{
+				metricLabelInstanceID:  "i-0abc123",
+				metricLabelNode:        "node-with-provider-id",
+				metricLabelProvisioner: provisioner,
+			}))
+
+			Expect(publishNodeInstanceInfo(false, provisioner, []v1.Node{*withProviderID, *withoutProviderID})).To(Succeed())
+			Expect(seriesFor(instanceInfoByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish whether nodes have the interruption taint", func() {
+			interrupted := test.Node(test.NodeOptions{Name: "interrupted-node", Taints: []v1.Taint{{Key: options.DefaultInterruptionTaintKey, Effect: v1.TaintEffectNoSchedule}}})
+			healthy := test.Node(test.NodeOptions{Name: "healthy-node"})
+			interruptedLabels := prometheus.Labels{metricLabelNode: interrupted.Name, metricLabelProvisioner: provisioner}
+			healthyLabels := prometheus.Labels{metricLabelNode: healthy.Name, metricLabelProvisioner: provisioner}
+
+			Expect(publishNodeInterruptions(getInterruptionTaintKey(context.Background()), provisioner, []v1.Node{*interrupted, *healthy})).To(Succeed())
+			Expect(gaugeValue(interruptionByNodeProvisioner, interruptedLabels)).To(BeNumerically("==", 1))
+			Expect(gaugeValue(interruptionByNodeProvisioner, healthyLabels)).To(BeNumerically("==", 0))
+		})
+		It("should only label node readiness with the ready condition message when enabled", func() {
+			node := test.Node(test.NodeOptions{Name: "unready-node", ReadyStatus: v1.ConditionFalse})
+			node.Status.Conditions[0].Message = "container runtime is down"
+			labelsWithMessage := func(message string) prometheus.Labels {
+				return prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner, metricLabelMessage: message}
+			}
+
+			Expect(publishNodeReadiness(false, provisioner, []v1.Node{*node})).To(Succeed())
+			Expect(seriesFor(readyByNodeProvisioner, provisioner)).To(ConsistOf(labelsWithMessage("")))
+			Expect(gaugeValue(readyByNodeProvisioner, labelsWithMessage(""))).To(BeNumerically("==", 0))
+
+			Expect(publishNodeReadiness(true, provisioner, []v1.Node{*node})).To(Succeed())
+			Expect(seriesFor(readyByNodeProvisioner, provisioner)).To(ConsistOf(labelsWithMessage("container runtime is down")))
+		})
+		It("should publish nodes with the bootstrap error condition", func() {
+			conditionType := v1.NodeConditionType("example.com/BootstrapFailed")
+			failed := test.Node(test.NodeOptions{Name: "failed-node"})
+			failed.Status.Conditions = append(failed.Status.Conditions, v1.NodeCondition{Type: conditionType, Status: v1.ConditionTrue})
+			recovered := test.Node(test.NodeOptions{Name: "recovered-node"})
+			recovered.Status.Conditions = append(recovered.Status.Conditions, v1.NodeCondition{Type: conditionType, Status: v1.ConditionFalse})
+			healthy := test.Node(test.NodeOptions{Name: "healthy-node"})
+			labelsFor := func(node *v1.Node) prometheus.Labels {
+				return prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner}
+			}
+
+			Expect(publishBootstrapErrors(conditionType, provisioner, []v1.Node{*failed, *recovered, *healthy})).To(Succeed())
+			Expect(gaugeValue(bootstrapErrorByNodeProvisioner, labelsFor(failed))).To(BeNumerically("==", 1))
+			Expect(gaugeValue(bootstrapErrorByNodeProvisioner, labelsFor(recovered))).To(BeNumerically("==", 0))
+			Expect(gaugeValue(bootstrapErrorByNodeProvisioner, labelsFor(healthy))).To(BeNumerically("==", 0))
+
+			Expect(publishBootstrapErrors("", provisioner, []v1.Node{*failed})).To(Succeed())
+			Expect(seriesFor(bootstrapErrorByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish the taint count of nodes until the provisioner is deleted", func() {
+			node := test.Node(test.NodeOptions{Name: "tainted-node", Taints: []v1.Taint{
+				{Key: "example.com/a", Effect: v1.TaintEffectNoSchedule},
+				{Key: "example.com/b", Effect: v1.TaintEffectNoExecute},
+				{Key: "example.com/c", Effect: v1.TaintEffectPreferNoSchedule},
+			}})
+			metricLabels := prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner}
+
+			Expect(publishNodeTaintCounts(provisioner, []v1.Node{*node})).To(Succeed())
+			Expect(gaugeValue(taintCountByNodeProvisioner, metricLabels)).To(BeNumerically("==", 3))
+
+			deleteNodeCounts(provisioner)
+			Expect(seriesFor(taintCountByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish daemonsets that are expected on a node but have no pod there", func() {
+			node := test.Node(test.NodeOptions{Name: "daemon-node", Taints: []v1.Taint{{Key: "example.com/a", Value: "b", Effect: v1.TaintEffectNoSchedule}}})
+			tolerations := []v1.Toleration{{Key: "example.com/a", Operator: v1.TolerationOpExists}}
+			absent := test.DaemonSet(test.DaemonSetOptions{Name: "absent", PodOptions: test.PodOptions{Tolerations: tolerations}})
+			present := test.DaemonSet(test.DaemonSetOptions{Name: "present", PodOptions: test.PodOptions{Tolerations: tolerations}})
+			intolerant := test.DaemonSet(test.DaemonSetOptions{Name: "intolerant"})
+			daemonPod := test.Pod(test.PodOptions{
+				NodeName:        node.Name,
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: present.Name, Controller: ptr.Bool(true)}},
+			})
+			labelsFor := func(daemonSet string) prometheus.Labels {
+				return prometheus.Labels{metricLabelNode: node.Name, metricLabelNamespace: "default", metricLabelDaemonSet: daemonSet, metricLabelProvisioner: provisioner}
+			}
+
+			Expect(publishMissingDaemons(provisioner, []v1.Node{*node}, []appsv1.DaemonSet{*absent, *present, *intolerant}, []v1.Pod{*daemonPod})).To(Succeed())
+			Expect(seriesFor(missingDaemonsByNodeProvisioner, provisioner)).To(ConsistOf(labelsFor(absent.Name)))
+			Expect(gaugeValue(missingDaemonsByNodeProvisioner, labelsFor(absent.Name))).To(BeNumerically("==", 1))
+
+			deleteNodeCounts(provisioner)
+			Expect(seriesFor(missingDaemonsByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should not expect daemonsets on nodes excluded by their required node affinity", func() {
+			node := test.Node(test.NodeOptions{Name: "affinity-node", Labels: map[string]string{v1.LabelTopologyZone: "test-zone-1"}})
+			included := test.DaemonSet(test.DaemonSetOptions{Name: "included", PodOptions: test.PodOptions{
+				NodeRequirements: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1"}}},
+			}})
+			excluded := test.DaemonSet(test.DaemonSetOptions{Name: "excluded", PodOptions: test.PodOptions{
+				NodeRequirements: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-2"}}},
+			}})
+			labelsFor := func(daemonSet string) prometheus.Labels {
+				return prometheus.Labels{metricLabelNode: node.Name, metricLabelNamespace: "default", metricLabelDaemonSet: daemonSet, metricLabelProvisioner: provisioner}
+			}
+
+			Expect(publishMissingDaemons(provisioner, []v1.Node{*node}, []appsv1.DaemonSet{*included, *excluded}, nil)).To(Succeed())
+			Expect(seriesFor(missingDaemonsByNodeProvisioner, provisioner)).To(ConsistOf(labelsFor(included.Name)))
+			deleteNodeCounts(provisioner)
+		})
+		It("should expect daemonsets on nodes with taints the daemonset controller tolerates", func() {
+			node := test.Node(test.NodeOptions{Name: "pressure-node", Taints: []v1.Taint{
+				{Key: v1.TaintNodeDiskPressure, Effect: v1.TaintEffectNoSchedule},
+				{Key: v1.TaintNodeUnschedulable, Effect: v1.TaintEffectNoSchedule},
+				{Key: v1.TaintNodeNotReady, Effect: v1.TaintEffectNoExecute},
+			}})
+			daemonSet := test.DaemonSet(test.DaemonSetOptions{Name: "tolerant"})
+			labels := prometheus.Labels{metricLabelNode: node.Name, metricLabelNamespace: "default", metricLabelDaemonSet: daemonSet.Name, metricLabelProvisioner: provisioner}
+
+			Expect(publishMissingDaemons(provisioner, []v1.Node{*node}, []appsv1.DaemonSet{*daemonSet}, nil)).To(Succeed())
+			Expect(seriesFor(missingDaemonsByNodeProvisioner, provisioner)).To(ConsistOf(labels))
+			deleteNodeCounts(provisioner)
+		})
+		It("should publish node counts by provisioner generation when enabled", func() {
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerGenerationLabelKey: "1"}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerGenerationLabelKey: "2"}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerGenerationLabelKey: "2"}}),
+			}
+			labelsForGeneration := func(generation string) prometheus.Labels {
+				return prometheus.Labels{metricLabelProvisioner: provisioner, metricLabelProvisionerGeneration: generation}
+			}
+
+			Expect(publishNodeGenerationCounts(true, provisioner, nodes)).To(Succeed())
+			Expect(seriesFor(nodeCountByProvisionerGeneration, provisioner)).To(ConsistOf(labelsForGeneration("1"), labelsForGeneration("2")))
+			Expect(gaugeValue(nodeCountByProvisionerGeneration, labelsForGeneration("1"))).To(BeNumerically("==", 1))
+			Expect(gaugeValue(nodeCountByProvisionerGeneration, labelsForGeneration("2"))).To(BeNumerically("==", 2))
+
+			Expect(publishNodeGenerationCounts(false, provisioner, nodes)).To(Succeed())
+			Expect(seriesFor(nodeCountByProvisionerGeneration, provisioner)).To(BeEmpty())
+		})
+		It("should publish whether nodes are stuck terminating", func() {
+			now := time.Now()
+			stuck := test.Node(test.NodeOptions{Name: "stuck-node"})
+			stuck.DeletionTimestamp = &metav1.Time{Time: now.Add(-20 * time.Minute)}
+			deleting := test.Node(test.NodeOptions{Name: "deleting-node"})
+			deleting.DeletionTimestamp = &metav1.Time{Time: now.Add(-time.Minute)}
+			healthy := test.Node(test.NodeOptions{Name: "healthy-node"})
+			labelsFor := func(node *v1.Node) prometheus.Labels {
+				return prometheus.Labels{metricLabelNode: node.Name, metricLabelProvisioner: provisioner}
+			}
+
+			Expect(publishStuckTerminating(15*time.Minute, provisioner, now, []v1.Node{*stuck, *deleting, *healthy})).To(Succeed())
+			Expect(gaugeValue(stuckTerminatingByNodeProvisioner, labelsFor(stuck))).To(BeNumerically("==", 1))
+			Expect(gaugeValue(stuckTerminatingByNodeProvisioner, labelsFor(deleting))).To(BeNumerically("==", 0))
+			Expect(gaugeValue(stuckTerminatingByNodeProvisioner, labelsFor(healthy))).To(BeNumerically("==", 0))
+
+			Expect(publishStuckTerminating(0, provisioner, now, []v1.Node{*stuck, *deleting, *healthy})).To(Succeed())
+			Expect(seriesFor(stuckTerminatingByNodeProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should read the interruption taint key from options", func() {
+			ctx := injection.WithOptions(context.Background(), options.Options{InterruptionTaintKey: "example.com/interruption"})
+			Expect(getInterruptionTaintKey(ctx)).To(Equal("example.com/interruption"))
+		})
+		It("should read the provisioner from a custom label key", func() {
+			customLabelKey := "example.com/provisioner-name"
+			Expect(metricLabelsFrom(customLabelKey, map[string]string{customLabelKey: provisioner})).To(Equal(prometheus.Labels{metricLabelProvisioner: provisioner}))
+			Expect(metricLabelsFrom(customLabelKey, map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner})).To(BeEmpty())
+		})
+	})
+
+	Context("Pods", func() {
+		It("should only include pods matching the pod metrics selector", func() {
+			matching := test.Pod(test.PodOptions{Labels: map[string]string{"karpenter.sh/managed": "true"}})
+			notMatching := test.Pod()
+			ctx := injection.WithOptions(context.Background(), options.Options{PodMetricsSelector: "karpenter.sh/managed=true"})
+
+			Expect(selectPods(getPodMetricsSelector(ctx), []v1.Pod{*matching, *notMatching})).To(ConsistOf(*matching))
+			Expect(selectPods(getPodMetricsSelector(context.Background()), []v1.Pod{*matching, *notMatching})).To(ConsistOf(*matching, *notMatching))
+		})
+		It("should publish the total container restarts", func() {
+			restarted := test.Pod()
+			restarted.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 3}, {RestartCount: 4}}
+			healthy := test.Pod()
+			healthy.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 0}}
+
+			Expect(publishPodRestarts(provisioner, []v1.Pod{*restarted, *healthy})).To(Succeed())
+			Expect(gaugeValue(podRestartsByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})).To(BeNumerically("==", 7))
+
+			Expect(publishPodRestarts(provisioner, []v1.Pod{*healthy})).To(Succeed())
+			Expect(gaugeValue(podRestartsByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})).To(BeNumerically("==", 0))
+		})
+		It("should publish the container restarts of each pod when enabled", func() {
+			restarted := test.Pod()
+			restarted.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 3}, {RestartCount: 4}}
+			healthy := test.Pod()
+			restartedLabels := prometheus.Labels{metricLabelNamespace: restarted.Namespace, metricLabelPod: restarted.Name, metricLabelProvisioner: provisioner}
+			healthyLabels := prometheus.Labels{metricLabelNamespace: healthy.Namespace, metricLabelPod: healthy.Name, metricLabelProvisioner: provisioner}
+
+			Expect(publishPodRestartsByPod(true, provisioner, []v1.Pod{*restarted, *healthy})).To(Succeed())
+			Expect(gaugeValue(podRestartsByNamespacePodProvisioner, restartedLabels)).To(BeNumerically("==", 7))
+			Expect(gaugeValue(podRestartsByNamespacePodProvisioner, healthyLabels)).To(BeNumerically("==", 0))
+
+			Expect(publishPodRestartsByPod(true, provisioner, []v1.Pod{*healthy})).To(Succeed())
+			Expect(seriesFor(podRestartsByNamespacePodProvisioner, provisioner)).To(ConsistOf(healthyLabels))
+
+			Expect(publishPodRestartsByPod(false, provisioner, []v1.Pod{*restarted, *healthy})).To(Succeed())
+			Expect(seriesFor(podRestartsByNamespacePodProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish pods missing requests by namespace and owner", func() {
+			owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-replicaset", UID: "test-uid", Controller: ptr.Bool(true)}
+			missingRequests := test.Pod(test.PodOptions{Namespace: "test-namespace", OwnerReferences: []metav1.OwnerReference{owner}})
+			withRequests := test.Pod(test.PodOptions{
+				Namespace:            "test-namespace",
+				OwnerReferences:      []metav1.OwnerReference{owner},
+				ResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+			})
+			labels := prometheus.Labels{
+				metricLabelNamespace:   "test-namespace",
+				metricLabelOwner:       "ReplicaSet/test-replicaset",
+				metricLabelOwnerKind:   "ReplicaSet",
+				metricLabelOwnerName:   "test-replicaset",
+				metricLabelProvisioner: provisioner,
+			}
+
+			Expect(publishPodsMissingRequests(provisioner, []v1.Pod{*missingRequests, *withRequests})).To(Succeed())
+			Expect(seriesFor(podsMissingRequestsByNamespaceOwnerProvisioner, provisioner)).To(ConsistOf(labels))
+			Expect(gaugeValue(podsMissingRequestsByNamespaceOwnerProvisioner, labels)).To(BeNumerically("==", 1))
+
+			Expect(publishPodsMissingRequests(provisioner, []v1.Pod{*withRequests})).To(Succeed())
+			Expect(seriesFor(podsMissingRequestsByNamespaceOwnerProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should label pods by the kind and name of their controller", func() {
+			owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-replicaset", UID: "test-uid", Controller: ptr.Bool(true)}
+			Expect(ownerOf(test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}})).labels()).To(Equal(prometheus.Labels{
+				metricLabelNamespace: "default",
+				metricLabelOwner:     "ReplicaSet/test-replicaset",
+				metricLabelOwnerKind: "ReplicaSet",
+				metricLabelOwnerName: "test-replicaset",
+			}))
+			Expect(ownerOf(test.Pod()).labels()).To(Equal(prometheus.Labels{
+				metricLabelNamespace: "default",
+				metricLabelOwner:     "",
+				metricLabelOwnerKind: "",
+				metricLabelOwnerName: "",
+			}))
+		})
+		It("should publish pod counts by owner and phase", func() {
+			owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-deployment-5d8f7c", UID: "test-uid", Controller: ptr.Bool(true)}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodPending}),
+			}
+			labelsInPhase := func(phase string) prometheus.Labels {
+				return prometheus.Labels{
+					metricLabelNamespace:   "default",
+					metricLabelOwner:       "ReplicaSet/test-deployment-5d8f7c",
+					metricLabelOwnerKind:   "ReplicaSet",
+					metricLabelOwnerName:   "test-deployment-5d8f7c",
+					metricLabelPhase:       phase,
+					metricLabelProvisioner: provisioner,
+				}
+			}
+
+			Expect(publishWorkloadPodCounts(provisioner, pods)).To(Succeed())
+			Expect(seriesFor(podCountByNamespaceOwnerPhaseProvisioner, provisioner)).To(ConsistOf(labelsInPhase("running"), labelsInPhase("pending")))
+			Expect(gaugeValue(podCountByNamespaceOwnerPhaseProvisioner, labelsInPhase("running"))).To(BeNumerically("==", 3))
+			Expect(gaugeValue(podCountByNamespaceOwnerPhaseProvisioner, labelsInPhase("pending"))).To(BeNumerically("==", 1))
+
+			Expect(publishWorkloadPodCounts(provisioner, pods[:2])).To(Succeed())
+			Expect(seriesFor(podCountByNamespaceOwnerPhaseProvisioner, provisioner)).To(ConsistOf(labelsInPhase("running")))
+			Expect(gaugeValue(podCountByNamespaceOwnerPhaseProvisioner, labelsInPhase("running"))).To(BeNumerically("==", 2))
+		})
+		It("should not publish terminal pods by owner and phase when disabled", func() {
+			owner := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "test-job", UID: "test-uid", Controller: ptr.Bool(true)}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodRunning}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodSucceeded}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}, Phase: v1.PodFailed}),
+			}
+			labelsInPhase := func(phase string) prometheus.Labels {
+				return prometheus.Labels{
+					metricLabelNamespace:   "default",
+					metricLabelOwner:       "Job/test-job",
+					metricLabelOwnerKind:   "Job",
+					metricLabelOwnerName:   "test-job",
+					metricLabelPhase:       phase,
+					metricLabelProvisioner: provisioner,
+				}
+			}
+
+			Expect(publishWorkloadPodCounts(provisioner, selectNonTerminalPods(true, pods))).To(Succeed())
+			Expect(seriesFor(podCountByNamespaceOwnerPhaseProvisioner, provisioner)).To(ConsistOf(labelsInPhase("running"), labelsInPhase("succeeded"), labelsInPhase("failed")))
+
+			Expect(publishWorkloadPodCounts(provisioner, selectNonTerminalPods(false, pods))).To(Succeed())
+			Expect(seriesFor(podCountByNamespaceOwnerPhaseProvisioner, provisioner)).To(ConsistOf(labelsInPhase("running")))
+		})
+		It("should publish the sum of pod requests by namespace", func() {
+			podRequesting := func(namespace string, cpu string, memory string) v1.Pod {
+				return *test.Pod(test.PodOptions{Namespace: namespace, Phase: v1.PodRunning, ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)},
+				}})
+			}
+			labelsFor := func(namespace string, resourceName v1.ResourceName) prometheus.Labels {
+				return prometheus.Labels{metricLabelNamespace: namespace, metricLabelResourceType: string(resourceName), metricLabelProvisioner: provisioner}
+			}
+			completed := podRequesting("team-a", "4", "4Gi")
+			completed.Status.Phase = v1.PodSucceeded
+			pods := []v1.Pod{
+				podRequesting("team-a", "500m", "1Gi"),
+				podRequesting("team-a", "1500m", "2Gi"),
+				completed,
+				podRequesting("team-b", "1", "1Gi"),
+			}
+
+			Expect(publishNamespacePodRequests(provisioner, pods)).To(Succeed())
+			Expect(gaugeValue(podRequestsByNamespaceResourceProvisioner, labelsFor("team-a", v1.ResourceCPU))).To(BeNumerically("==", 2))
+			Expect(gaugeValue(podRequestsByNamespaceResourceProvisioner, labelsFor("team-a", v1.ResourceMemory))).To(BeNumerically("==", 3*1024*1024*1024))
+
+			Expect(publishNamespacePodRequests(provisioner, pods[:1])).To(Succeed())
+			Expect(gaugeValue(podRequestsByNamespaceResourceProvisioner, labelsFor("team-a", v1.ResourceCPU))).To(BeNumerically("==", 0.5))
+			Expect(seriesFor(podRequestsByNamespaceResourceProvisioner, provisioner)).To(ConsistOf(
+				labelsFor("team-a", v1.ResourceCPU),
+				labelsFor("team-a", v1.ResourceMemory),
+			))
+		})
+		It("should count each evicted pod once", func() {
+			evicted := test.Pod(test.PodOptions{Phase: v1.PodFailed})
+			evicted.UID = "evicted-pod"
+			evicted.Status.Reason = "Evicted"
+			failed := test.Pod(test.PodOptions{Phase: v1.PodFailed})
+			failed.UID = "failed-pod"
+			running := test.Pod(test.PodOptions{Phase: v1.PodRunning})
+			running.UID = "running-pod"
+			counter := evictedPodsCounterByProvisioner.WithLabelValues(provisioner)
+
+			Expect(countEvictedPods(provisioner, []v1.Pod{*evicted, *failed, *running})).To(Succeed())
+			Expect(testutil.ToFloat64(counter)).To(BeNumerically("==", 1))
+			Expect(countEvictedPods(provisioner, []v1.Pod{*evicted, *failed, *running})).To(Succeed())
+			Expect(testutil.ToFloat64(counter)).To(BeNumerically("==", 1))
+
+			another := evicted.DeepCopy()
+			another.UID = "another-evicted-pod"
+			Expect(countEvictedPods(provisioner, []v1.Pod{*evicted, *another})).To(Succeed())
+			Expect(testutil.ToFloat64(counter)).To(BeNumerically("==", 2))
+
+			deleteEvictedPodCount(provisioner)
+			Expect(testutil.ToFloat64(evictedPodsCounterByProvisioner.WithLabelValues(provisioner))).To(BeNumerically("==", 0))
+		})
+		It("should observe the pending duration of each pod once when it is scheduled", func() {
+			created := metav1.NewTime(time.Now().Add(-45 * time.Second))
+			pending := test.Pod(test.PodOptions{Phase: v1.PodPending})
+			pending.UID = "pending-pod"
+			pending.CreationTimestamp = created
+			scheduled := test.Pod(test.PodOptions{NodeName: "node", Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(created.Add(30 * time.Second))},
+			}})
+			scheduled.UID = pending.UID
+			scheduled.CreationTimestamp = created
+			unknownPending := test.Pod(test.PodOptions{Phase: v1.PodPending})
+			unknownPending.UID = "unknown-pod"
+			unknown := test.Pod(test.PodOptions{NodeName: "node"})
+			unknown.UID = unknownPending.UID
+			alreadyScheduled := scheduled.DeepCopy()
+			alreadyScheduled.UID = "already-scheduled-pod"
+			histogramFor := func() *dto.Histogram {
+				written := &dto.Metric{}
+				observer, err := pendingDurationByProvisioner.GetMetricWithLabelValues(provisioner)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(observer.(prometheus.Metric).Write(written)).To(Succeed())
+				return written.GetHistogram()
+			}
+
+			Expect(observePendingDurations(provisioner, []v1.Pod{*pending, *unknownPending, *alreadyScheduled})).To(Succeed())
+			Expect(histogramFor().GetSampleCount()).To(BeNumerically("==", 0))
+
+			Expect(observePendingDurations(provisioner, []v1.Pod{*scheduled, *unknown, *alreadyScheduled})).To(Succeed())
+			Expect(histogramFor().GetSampleCount()).To(BeNumerically("==", 1))
+			Expect(histogramFor().GetSampleSum()).To(BeNumerically("~", 30, 0.001))
+
+			Expect(observePendingDurations(provisioner, []v1.Pod{*scheduled, *unknown, *alreadyScheduled})).To(Succeed())
+			Expect(histogramFor().GetSampleCount()).To(BeNumerically("==", 1))
+
+			deletePendingDurations(provisioner)
+			Expect(histogramFor().GetSampleCount()).To(BeNumerically("==", 0))
+		})
+		It("should publish pending pods by the provisioner they select", func() {
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{Phase: v1.PodPending, NodeSelector: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}}),
+				*test.Pod(test.PodOptions{Phase: v1.PodPending, NodeRequirements: []v1.NodeSelectorRequirement{
+					{Key: v1alpha5.ProvisionerNameLabelKey, Operator: v1.NodeSelectorOpIn, Values: []string{"other", provisioner}},
+				}}),
+				*test.Pod(test.PodOptions{Phase: v1.PodPending, NodeSelector: map[string]string{v1alpha5.ProvisionerNameLabelKey: "other"}}),
+				*test.Pod(test.PodOptions{Phase: v1.PodPending}),
+				*test.Pod(test.PodOptions{Phase: v1.PodPending, NodeName: "scheduled-node", NodeSelector: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner}}),
+			}
+
+			Expect(publishPendingPodCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, pods)).To(Succeed())
+			Expect(gaugeValue(pendingPodCountByProvisioner, prometheus.Labels{metricLabelProvisioner: provisioner})).To(BeNumerically("==", 2))
+			Expect(gaugeValue(pendingPodCountByProvisioner, prometheus.Labels{metricLabelProvisioner: pendingPodsNoProvisioner})).To(BeNumerically("==", 1))
+
+			Expect(publishPendingPodCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, pods[:3])).To(Succeed())
+			Expect(seriesFor(pendingPodCountByProvisioner, pendingPodsNoProvisioner)).To(BeEmpty())
+
+			Expect(publishPendingPodCounts(v1alpha5.ProvisionerNameLabelKey, provisioner, pods)).To(Succeed())
+			deletePendingPodCount(provisioner)
+			Expect(seriesFor(pendingPodCountByProvisioner, provisioner)).To(BeEmpty())
+			Expect(seriesFor(pendingPodCountByProvisioner, pendingPodsNoProvisioner)).To(BeEmpty())
+		})
+		It("should publish pending pods with volumes that require zones without a ready node", func() {
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Labels: map[string]string{nodeLabelZone: "test-zone-1"}}),
+				*test.Node(test.NodeOptions{Labels: map[string]string{nodeLabelZone: "test-zone-2"}, ReadyStatus: v1.ConditionFalse}),
+			}
+			podInZone := func(name string, zone string, withVolume bool) v1.Pod {
+				p := test.Pod(test.PodOptions{Name: name, Phase: v1.PodPending, NodeSelector: map[string]string{
+					v1alpha5.ProvisionerNameLabelKey: provisioner,
+					v1.LabelTopologyZone:             zone,
+				}})
+				if withVolume {
+					p.Spec.Volumes = []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{
+						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+					}}}
+				}
+				return *p
+			}
+			pods := []v1.Pod{
+				podInZone("waiting-pod", "test-zone-2", true),
+				podInZone("satisfiable-pod", "test-zone-1", true),
+				podInZone("volumeless-pod", "test-zone-2", false),
+			}
+
+			Expect(publishPodsWaitingForVolumeZone(v1alpha5.ProvisionerNameLabelKey, provisioner, pods, nodes)).To(Succeed())
+			Expect(seriesFor(podsWaitingForVolumeZoneByProvisioner, provisioner)).To(ConsistOf(prometheus.Labels{
+				metricLabelNamespace:   "default",
+				metricLabelPod:         "waiting-pod",
+				metricLabelProvisioner: provisioner,
+			}))
+
+			Expect(publishPodsWaitingForVolumeZone(v1alpha5.ProvisionerNameLabelKey, provisioner, pods[1:], nodes)).To(Succeed())
+			Expect(seriesFor(podsWaitingForVolumeZoneByProvisioner, provisioner)).To(BeEmpty())
+		})
+		It("should publish the zone distribution of pods by owner", func() {
+			owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "test-replicaset", UID: "test-uid", Controller: ptr.Bool(true)}
+			nodes := []v1.Node{
+				*test.Node(test.NodeOptions{Name: "node-a", Labels: map[string]string{nodeLabelZone: "test-zone-1"}}),
+				*test.Node(test.NodeOptions{Name: "node-b", Labels: map[string]string{nodeLabelZone: "test-zone-2"}}),
+			}
+			pods := []v1.Pod{
+				*test.Pod(test.PodOptions{NodeName: "node-a", OwnerReferences: []metav1.OwnerReference{owner}}),
+				*test.Pod(test.PodOptions{NodeName: "node-a", OwnerReferences: []metav1.OwnerReference{owner}}),
+				*test.Pod(test.PodOptions{NodeName: "node-b", OwnerReferences: []metav1.OwnerReference{owner}}),
+				*test.Pod(test.PodOptions{OwnerReferences: []metav1.OwnerReference{owner}}),
+			}
+			labelsInZone := func(zone string) prometheus.Labels {
+				return prometheus.Labels{
+					metricLabelNamespace:   "default",
+					metricLabelOwner:       "ReplicaSet/test-replicaset",
+					metricLabelOwnerKind:   "ReplicaSet",
+					metricLabelOwnerName:   "test-replicaset",
+					metricLabelProvisioner: provisioner,
+					metricLabelZone:        zone,
+				}
+			}
+
+			Expect(publishPodZoneDistribution(provisioner, pods, nodes)).To(Succeed())
+			Expect(seriesFor(podCountByNamespaceOwnerProvisionerZone, provisioner)).To(ConsistOf(labelsInZone("test-zone-1"), labelsInZone("test-zone-2")))
+			Expect(gaugeValue(podCountByNamespaceOwnerProvisionerZone, labelsInZone("test-zone-1"))).To(BeNumerically("==", 2))
+			Expect(gaugeValue(podCountByNamespaceOwnerProvisionerZone, labelsInZone("test-zone-2"))).To(BeNumerically("==", 1))
+		})
+	})
+})
+
+// consumeNodesFrom returns a consumeNodesWithFunc that filters the given nodes
+// by the matching labels, standing in for a List call against the API server.
+func consumeNodesFrom(nodes []v1.Node) consumeNodesWithFunc {
+	return func(matchingLabels client.MatchingLabels, consume nodeListConsumerFunc) error {
+		selector := labels.SelectorFromSet(labels.Set(matchingLabels))
+		matched := []v1.Node{}
+		for _, node := range nodes {
+			if selector.Matches(labels.Set(node.Labels)) {
+				matched = append(matched, node)
+			}
+		}
+		return consume(matched)
+	}
+}
+
+// newKubeClient returns a fake client with the Karpenter and client-go schemes
+// registered, populated with the given objects.
+func newKubeClient(objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(apis.AddToScheme(scheme)).To(Succeed())
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	return crfake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+// seriesFor returns the label sets of all series in the GaugeVec for the provisioner.
+func seriesFor(gaugeVec *prometheus.GaugeVec, provisioner string) []prometheus.Labels {
+	metrics := make(chan prometheus.Metric, 1000)
+	gaugeVec.Collect(metrics)
+	close(metrics)
+	series := []prometheus.Labels{}
+	for metric := range metrics {
+		written := &dto.Metric{}
+		Expect(metric.Write(written)).To(Succeed())
+		labels := prometheus.Labels{}
+		for _, label := range written.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels[metricLabelProvisioner] == provisioner {
+			series = append(series, labels)
+		}
+	}
+	return series
+}
+
+func gaugeValue(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels) float64 {
+	gauge, err := gaugeVec.GetMetricWith(labels)
+	Expect(err).ToNot(HaveOccurred())
+	return testutil.ToFloat64(gauge)
+}
@@ -25,6 +25,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"knative.dev/pkg/logging"
 	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -33,19 +34,47 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/node"
 	"github.com/aws/karpenter/pkg/utils/result"
 )
 
 const controllerName = "node"
 
+// ControllerOption customizes the Controller constructed by NewController
+type ControllerOption func(c *Controller)
+
+// WithLiveness replaces the liveness subreconciler of the Controller
+func WithLiveness(liveness Subreconciler) ControllerOption {
+	return func(c *Controller) {
+		c.liveness = liveness
+	}
+}
+
 // NewController constructs a controller instance
-func NewController(kubeClient client.Client) *Controller {
-	return &Controller{
+func NewController(kubeClient client.Client, options ...ControllerOption) *Controller {
+	c := &Controller{
 		kubeClient: kubeClient,
-		liveness:   &Liveness{kubeClient: kubeClient},
+		liveness:   NewLiveness(kubeClient),
 		emptiness:  &Emptiness{kubeClient: kubeClient},
 		expiration: &Expiration{kubeClient: kubeClient},
 	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Subreconciler reconciles a property of a node provisioned by the provisioner.
+// Changes to the node are patched by the Controller.
+type Subreconciler interface {
+	Reconcile(context.Context, *v1alpha5.Provisioner, *v1.Node) (reconcile.Result, error)
+}
+
+// Forgetter is implemented by subreconcilers that keep state for nodes, which is
+// released once the node is not found or is being deleted.
+type Forgetter interface {
+	Forget(name string)
 }
 
 // Controller manages a set of properties on karpenter provisioned nodes, such as
@@ -53,7 +82,7 @@ func NewController(kubeClient client.Client) *Controller {
 type Controller struct {
 	kubeClient client.Client
 	readiness  *Readiness
-	liveness   *Liveness
+	liveness   Subreconciler
 	emptiness  *Emptiness
 	expiration *Expiration
 	finalizer  *Finalizer
@@ -66,20 +95,22 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	stored := &v1.Node{}
 	if err := c.kubeClient.Get(ctx, req.NamespacedName, stored); err != nil {
 		if errors.IsNotFound(err) {
+			c.forget(req.Name)
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, err
 	}
-	if _, ok := stored.Labels[v1alpha5.ProvisionerNameLabelKey]; !ok {
+	if !node.IsManaged(ctx, stored) {
 		return reconcile.Result{}, nil
 	}
 	if !stored.DeletionTimestamp.IsZero() {
+		c.forget(req.Name)
 		return reconcile.Result{}, nil
 	}
 
 	// 2. Retrieve Provisioner
 	provisioner := &v1alpha5.Provisioner{}
-	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: stored.Labels[v1alpha5.ProvisionerNameLabelKey]}, provisioner); err != nil {
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: stored.Labels[node.GetProvisionerLabelKey(ctx)]}, provisioner); err != nil {
 		if errors.IsNotFound(err) {
 			return reconcile.Result{}, nil
 		}
@@ -87,28 +118,30 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	}
 
 	// 3. Execute reconcilers
-	node := stored.DeepCopy()
+	updated := stored.DeepCopy()
 	var results []reconcile.Result
 	var errs error
-	for _, reconciler := range []interface {
-		Reconcile(context.Context, *v1alpha5.Provisioner, *v1.Node) (reconcile.Result, error)
-	}{
+	for _, reconciler := range []Subreconciler{
 		c.readiness,
 		c.liveness,
 		c.expiration,
 		c.emptiness,
 		c.finalizer,
 	} {
-		res, err := reconciler.Reconcile(ctx, provisioner, node)
+		res, err := reconciler.Reconcile(ctx, provisioner, updated)
 		errs = multierr.Append(errs, err)
 		results = append(results, res)
 	}
 
-	// 4. Patch any changes, regardless of errors
-	if !equality.Semantic.DeepEqual(node, stored) {
-		if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+	// 4. Patch any changes, regardless of errors, unless in read-only mode
+	if !equality.Semantic.DeepEqual(updated, stored) && !injection.GetOptions(ctx).ReadOnly {
+		if err := c.kubeClient.Patch(ctx, updated, client.MergeFrom(stored)); err != nil {
 			return reconcile.Result{}, fmt.Errorf("patching node, %w", err)
 		}
+		// The NotReady taint is only removed once, when the node first becomes ready
+		if hasNotReadyTaint(stored) && !hasNotReadyTaint(updated) {
+			nodesJoinedCounter.WithLabelValues(provisioner.Name).Inc()
+		}
 	}
 	// 5. Requeue if error or if retryAfter is set
 	if errs != nil {
@@ -117,17 +150,24 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	return result.Min(results...), nil
 }
 
+// forget releases the state subreconcilers keep for the node
+func (c *Controller) forget(name string) {
+	if forgetter, ok := c.liveness.(Forgetter); ok {
+		forgetter.Forget(name)
+	}
+}
+
 func (c *Controller) Register(ctx context.Context, m manager.Manager) error {
 	return controllerruntime.
 		NewControllerManagedBy(m).
 		Named(controllerName).
-		For(&v1.Node{}).
+		For(&v1.Node{}, builder.WithPredicates(node.ManagedPredicate(ctx), node.IgnoreHeartbeatsPredicate())).
 		Watches(
 			// Reconcile all nodes related to a provisioner when it changes.
 			&source.Kind{Type: &v1alpha5.Provisioner{}},
 			handler.EnqueueRequestsFromMapFunc(func(o client.Object) (requests []reconcile.Request) {
 				nodes := &v1.NodeList{}
-				if err := c.kubeClient.List(ctx, nodes, client.MatchingLabels(map[string]string{v1alpha5.ProvisionerNameLabelKey: o.GetName()})); err != nil {
+				if err := c.kubeClient.List(ctx, nodes, client.MatchingLabels(map[string]string{node.GetProvisionerLabelKey(ctx): o.GetName()})); err != nil {
 					logging.FromContext(ctx).Errorf("Failed to list nodes when mapping expiration watch events, %s", err.Error())
 					return requests
 				}
@@ -147,6 +187,9 @@ func (c *Controller) Register(ctx context.Context, m manager.Manager) error {
 				return requests
 			}),
 		).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 10}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: 10,
+			RateLimiter:             injection.GetOptions(ctx).ReconcileRateLimiter(),
+		}).
 		Complete(c)
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/utils/functional"
 	"github.com/aws/karpenter/pkg/utils/injectabletime"
+	"github.com/aws/karpenter/pkg/utils/injection"
 	"github.com/aws/karpenter/pkg/utils/node"
 	"github.com/aws/karpenter/pkg/utils/pod"
 	"github.com/aws/karpenter/pkg/utils/ptr"
@@ -73,6 +74,10 @@ func (r *Emptiness) Reconcile(ctx context.Context, provisioner *v1alpha5.Provisi
 		return reconcile.Result{}, fmt.Errorf("parsing emptiness timestamp, %s", emptinessTimestamp)
 	}
 	if injectabletime.Now().After(emptinessTime.Add(ttl)) {
+		if injection.GetOptions(ctx).ReadOnly {
+			logging.FromContext(ctx).Infof("Would trigger termination after %s for empty node, skipping in read-only mode", ttl)
+			return reconcile.Result{}, nil
+		}
 		logging.FromContext(ctx).Infof("Triggering termination after %s for empty node", ttl)
 		if err := r.kubeClient.Delete(ctx, n); err != nil {
 			return reconcile.Result{}, fmt.Errorf("deleting node, %w", err)
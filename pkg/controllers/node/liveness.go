@@ -17,10 +17,13 @@ package node
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"github.com/aws/karpenter/pkg/metrics"
 	"github.com/aws/karpenter/pkg/utils/injectabletime"
+	"github.com/aws/karpenter/pkg/utils/injection"
 	"github.com/aws/karpenter/pkg/utils/node"
 	v1 "k8s.io/api/core/v1"
 	"knative.dev/pkg/logging"
@@ -30,28 +33,98 @@ import (
 
 const LivenessTimeout = 15 * time.Minute
 
+// BootstrapStageTimeout is how long a node's bootstrap stage may remain
+// unchanged before the node is no longer considered to be bootstrapping.
+const BootstrapStageTimeout = 5 * time.Minute
+
 // Liveness is a subreconciler that deletes nodes determined to be unrecoverable
 type Liveness struct {
 	kubeClient client.Client
+	// bootstrapStages records the last bootstrap stage observed for each node
+	bootstrapStages sync.Map
+}
+
+// NewLiveness constructs a liveness subreconciler
+func NewLiveness(kubeClient client.Client) *Liveness {
+	return &Liveness{kubeClient: kubeClient}
+}
+
+type bootstrapStage struct {
+	stage    string
+	observed time.Time
 }
 
 // Reconcile reconciles the node
-func (r *Liveness) Reconcile(ctx context.Context, _ *v1alpha5.Provisioner, n *v1.Node) (reconcile.Result, error) {
-	if timeSinceCreation := injectabletime.Now().Sub(n.GetCreationTimestamp().Time); timeSinceCreation < LivenessTimeout {
+func (r *Liveness) Reconcile(ctx context.Context, provisioner *v1alpha5.Provisioner, n *v1.Node) (result reconcile.Result, err error) {
+	defer func() { metrics.ObserveRequeue("liveness", result, err) }()
+	// Ready nodes have finished bootstrapping
+	if node.IsReady(n) {
+		r.Forget(n.Name)
+	}
+	timeSinceCreation := injectabletime.Now().Sub(n.GetCreationTimestamp().Time)
+	// A clock behind the node's creation timestamp, due to skew or a mocked
+	// clock, is treated as the node having just been created.
+	if timeSinceCreation < 0 {
+		timeSinceCreation = 0
+	}
+	if timeSinceCreation < LivenessTimeout {
 		return reconcile.Result{RequeueAfter: LivenessTimeout - timeSinceCreation}, nil
 	}
 	condition := node.GetCondition(n.Status.Conditions, v1.NodeReady)
-	// If the reason is "", then the condition has never been set. We expect
-	// either the kubelet to set this reason, or the kcm's
-	// node-lifecycle-controller to set the status to NodeStatusNeverUpdated if
-	// the kubelet cannot connect. Once the value is NodeStatusNeverUpdated and
-	// the node is beyond the liveness timeout, we will delete the node.
-	if condition.Reason != "" && condition.Reason != "NodeStatusNeverUpdated" {
+	if !failedToJoin(condition) && !(injection.GetOptions(ctx).ReapNotReadyNodes && notReadyPastTimeout(condition)) {
+		return reconcile.Result{}, nil
+	}
+	if r.isBootstrapping(n) {
+		logging.FromContext(ctx).Debugf("Skipping termination for node that is still bootstrapping")
+		return reconcile.Result{RequeueAfter: BootstrapStageTimeout}, nil
+	}
+	if injection.GetOptions(ctx).ReadOnly {
+		logging.FromContext(ctx).Infof("Would trigger termination for node that failed to join, skipping in read-only mode")
 		return reconcile.Result{}, nil
 	}
 	logging.FromContext(ctx).Infof("Triggering termination for node that failed to join")
 	if err := r.kubeClient.Delete(ctx, n); err != nil {
 		return reconcile.Result{}, fmt.Errorf("deleting node, %w", err)
 	}
+	r.Forget(n.Name)
+	nodesFailedJoinCounter.WithLabelValues(provisioner.Name).Inc()
 	return reconcile.Result{}, nil
 }
+
+// Forget releases the bootstrap stage recorded for the node
+func (r *Liveness) Forget(name string) {
+	r.bootstrapStages.Delete(name)
+}
+
+// isBootstrapping returns true if the node's bootstrap stage annotation, written
+// by its bootstrap script, has changed within the BootstrapStageTimeout.
+func (r *Liveness) isBootstrapping(n *v1.Node) bool {
+	stage, ok := n.Annotations[v1alpha5.BootstrapStageAnnotationKey]
+	if !ok {
+		return false
+	}
+	now := injectabletime.Now()
+	if last, ok := r.bootstrapStages.Load(n.Name); ok && last.(bootstrapStage).stage == stage {
+		return now.Sub(last.(bootstrapStage).observed) < BootstrapStageTimeout
+	}
+	r.bootstrapStages.Store(n.Name, bootstrapStage{stage: stage, observed: now})
+	return true
+}
+
+// failedToJoin returns true if the node never reported its readiness. If the
+// reason is "", then the condition has never been set. We expect either the
+// kubelet to set this reason, or the kcm's node-lifecycle-controller to set the
+// status to NodeStatusNeverUpdated if the kubelet cannot connect.
+func failedToJoin(condition v1.NodeCondition) bool {
+	return condition.Reason == "" || condition.Reason == "NodeStatusNeverUpdated"
+}
+
+// notReadyPastTimeout returns true if the node has been continuously NotReady
+// for longer than the liveness timeout, such as a node that flapped after
+// becoming Ready once.
+func notReadyPastTimeout(condition v1.NodeCondition) bool {
+	if condition.Status == v1.ConditionTrue || condition.LastTransitionTime.IsZero() {
+		return false
+	}
+	return injectabletime.Now().Sub(condition.LastTransitionTime.Time) >= LivenessTimeout
+}
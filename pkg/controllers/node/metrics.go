@@ -0,0 +1,47 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	nodesJoinedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "provisioner",
+			Name:      "nodes_joined_total",
+			Help:      "Count of nodes that became ready for the first time by provisioner.",
+		},
+		[]string{metrics.ProvisionerLabel},
+	)
+	nodesFailedJoinCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "provisioner",
+			Name:      "nodes_failed_join_total",
+			Help:      "Count of nodes deleted for failing to join the cluster by provisioner.",
+		},
+		[]string{metrics.ProvisionerLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(nodesJoinedCounter)
+	crmetrics.Registry.MustRegister(nodesFailedJoinCounter)
+}
@@ -40,3 +40,13 @@ func (r *Readiness) Reconcile(_ context.Context, _ *v1alpha5.Provisioner, n *v1.
 	n.Spec.Taints = taints
 	return reconcile.Result{}, nil
 }
+
+// hasNotReadyTaint returns true if the node has the NotReady taint
+func hasNotReadyTaint(n *v1.Node) bool {
+	for _, taint := range n.Spec.Taints {
+		if taint.Key == v1alpha5.NotReadyTaintKey {
+			return true
+		}
+	}
+	return false
+}
@@ -23,8 +23,11 @@ import (
 	"github.com/Pallinder/go-randomdata"
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/controllers/node"
+	"github.com/aws/karpenter/pkg/metrics"
 	"github.com/aws/karpenter/pkg/test"
 	"github.com/aws/karpenter/pkg/utils/injectabletime"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
 
 	. "github.com/aws/karpenter/pkg/test/expectations"
 	. "github.com/onsi/ginkgo"
@@ -34,6 +37,8 @@ import (
 	. "knative.dev/pkg/logging/testing"
 	"knative.dev/pkg/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var ctx context.Context
@@ -116,6 +121,22 @@ var _ = Describe("Controller", func() {
 			n = ExpectNodeExists(ctx, env.Client, n.Name)
 			Expect(n.DeletionTimestamp.IsZero()).To(BeFalse())
 		})
+		It("should not delete expired nodes in read-only mode", func() {
+			provisioner.Spec.TTLSecondsUntilExpired = ptr.Int64(30)
+			n := test.Node(test.NodeOptions{
+				Finalizers: []string{v1alpha5.TerminationFinalizer},
+				Labels:     map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+			})
+			ExpectCreated(ctx, env.Client, provisioner, n)
+
+			// Simulate time passing
+			injectabletime.Now = func() time.Time {
+				return time.Now().Add(time.Duration(*provisioner.Spec.TTLSecondsUntilExpired) * time.Second)
+			}
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(n))
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
 	})
 
 	Context("Readiness", func() {
@@ -151,6 +172,32 @@ var _ = Describe("Controller", func() {
 			n = ExpectNodeExists(ctx, env.Client, n.Name)
 			Expect(n.Spec.Taints).ToNot(Equal([]v1.Taint{n.Spec.Taints[1]}))
 		})
+		It("should count nodes that join once", func() {
+			n := test.Node(test.NodeOptions{
+				ReadyStatus: v1.ConditionTrue,
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Taints:      []v1.Taint{{Key: v1alpha5.NotReadyTaintKey, Effect: v1.TaintEffectNoSchedule}},
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+			joined := counterValue("karpenter_provisioner_nodes_joined_total", provisioner.Name)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+			Expect(counterValue("karpenter_provisioner_nodes_joined_total", provisioner.Name)).To(Equal(joined + 1))
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+			Expect(counterValue("karpenter_provisioner_nodes_joined_total", provisioner.Name)).To(Equal(joined + 1))
+		})
+		It("should not count nodes that join until the taint removal is persisted", func() {
+			n := test.Node(test.NodeOptions{
+				ReadyStatus: v1.ConditionTrue,
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Taints:      []v1.Taint{{Key: v1alpha5.NotReadyTaintKey, Effect: v1.TaintEffectNoSchedule}},
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+			joined := counterValue("karpenter_provisioner_nodes_joined_total", provisioner.Name)
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(n))
+			Expect(counterValue("karpenter_provisioner_nodes_joined_total", provisioner.Name)).To(Equal(joined))
+		})
 		It("should do nothing if ready and the readiness taint does not exist", func() {
 			n := test.Node(test.NodeOptions{
 				ReadyStatus: v1.ConditionTrue,
@@ -190,6 +237,7 @@ var _ = Describe("Controller", func() {
 			})
 			ExpectCreated(ctx, env.Client, provisioner)
 			ExpectCreatedWithStatus(ctx, env.Client, n)
+			failedJoins := counterValue("karpenter_provisioner_nodes_failed_join_total", provisioner.Name)
 
 			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(provisioner))
 
@@ -201,6 +249,213 @@ var _ = Describe("Controller", func() {
 			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
 			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
 
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeFalse())
+			Expect(counterValue("karpenter_provisioner_nodes_failed_join_total", provisioner.Name)).To(Equal(failedJoins + 1))
+		})
+		It("should requeue for the full timeout if the clock is behind the node's creation", func() {
+			n := test.Node(test.NodeOptions{ReadyStatus: v1.ConditionUnknown})
+			n.CreationTimestamp = metav1.Now()
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(-time.Hour) }
+			result, err := (&node.Liveness{}).Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(node.LivenessTimeout))
+		})
+		It("should requeue for the remaining time just before the timeout", func() {
+			n := test.Node(test.NodeOptions{ReadyStatus: v1.ConditionUnknown})
+			n.CreationTimestamp = metav1.Now()
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(node.LivenessTimeout - time.Second) }
+			result, err := (&node.Liveness{}).Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Second))
+		})
+		It("should delete nodes that failed to join when constructed as a subreconciler", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			var liveness node.Subreconciler = node.NewLiveness(env.Client)
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			_, err := liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeFalse())
+		})
+		It("should reconcile with an injected liveness subreconciler", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			liveness := &fakeLiveness{result: reconcile.Result{RequeueAfter: time.Minute}}
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			result, err := node.NewController(env.Client, node.WithLiveness(liveness)).Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(n)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(liveness.reconciled).To(ConsistOf(n.Name))
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+		It("should not delete nodes in read-only mode", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			// Simulate time passing and a n failing to join
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(n))
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+		It("should delete nodes that were Ready and then NotReady past the timeout if enabled", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				ReadyStatus: v1.ConditionFalse,
+				ReadyReason: "KubeletNotReady",
+			})
+			n.Status.Conditions[0].LastTransitionTime = metav1.Now()
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+			reapCtx := injection.WithOptions(ctx, options.Options{ReapNotReadyNodes: true})
+
+			ExpectReconcileSucceeded(reapCtx, controller, client.ObjectKeyFromObject(n))
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+
+			// Simulate the node remaining NotReady past the timeout
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			ExpectReconcileSucceeded(reapCtx, controller, client.ObjectKeyFromObject(n))
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeFalse())
+		})
+		It("should not delete nodes that were Ready and then NotReady past the timeout if disabled", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				ReadyStatus: v1.ConditionFalse,
+				ReadyReason: "KubeletNotReady",
+			})
+			n.Status.Conditions[0].LastTransitionTime = metav1.Now()
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+		It("should not delete nodes while their bootstrap stage is advancing", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Annotations: map[string]string{v1alpha5.BootstrapStageAnnotationKey: "1"},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+
+			// Simulate the bootstrap script advancing to the next stage
+			n.Annotations[v1alpha5.BootstrapStageAnnotationKey] = "2"
+			ExpectApplied(ctx, env.Client, n)
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout + node.BootstrapStageTimeout) }
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+		It("should forget the bootstrap stage of nodes that become ready", func() {
+			n := test.Node(test.NodeOptions{
+				Annotations: map[string]string{v1alpha5.BootstrapStageAnnotationKey: "1"},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			n.CreationTimestamp = metav1.Now()
+			liveness := node.NewLiveness(env.Client)
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(node.LivenessTimeout) }
+			result, err := liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(node.BootstrapStageTimeout))
+
+			n.Status.Conditions[0].Status = v1.ConditionTrue
+			n.Status.Conditions[0].Reason = "KubeletReady"
+			_, err = liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The stage is observed anew rather than considered stalled
+			n.Status.Conditions[0].Status = v1.ConditionUnknown
+			n.Status.Conditions[0].Reason = "NodeStatusNeverUpdated"
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(node.LivenessTimeout + node.BootstrapStageTimeout) }
+			result, err = liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(node.BootstrapStageTimeout))
+		})
+		It("should forget the bootstrap stage of nodes that are not found", func() {
+			n := test.Node(test.NodeOptions{
+				Annotations: map[string]string{v1alpha5.BootstrapStageAnnotationKey: "1"},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			n.CreationTimestamp = metav1.Now()
+			liveness := node.NewLiveness(env.Client)
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(node.LivenessTimeout) }
+			result, err := liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(node.BootstrapStageTimeout))
+
+			ExpectReconcileSucceeded(ctx, node.NewController(env.Client, node.WithLiveness(liveness)), client.ObjectKeyFromObject(n))
+
+			// The stage is observed anew rather than considered stalled
+			injectabletime.Now = func() time.Time { return n.CreationTimestamp.Add(node.LivenessTimeout + node.BootstrapStageTimeout) }
+			result, err = liveness.Reconcile(ctx, provisioner, n)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(node.BootstrapStageTimeout))
+		})
+		It("should delete nodes once their bootstrap stage stalls", func() {
+			n := test.Node(test.NodeOptions{
+				Finalizers:  []string{v1alpha5.TerminationFinalizer},
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Annotations: map[string]string{v1alpha5.BootstrapStageAnnotationKey: "1"},
+				ReadyStatus: v1.ConditionUnknown,
+				ReadyReason: "NodeStatusNeverUpdated",
+			})
+			ExpectCreated(ctx, env.Client, provisioner)
+			ExpectCreatedWithStatus(ctx, env.Client, n)
+
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout) }
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.DeletionTimestamp.IsZero()).To(BeTrue())
+
+			// Simulate the bootstrap stage remaining unchanged past the timeout
+			injectabletime.Now = func() time.Time { return time.Now().Add(node.LivenessTimeout + node.BootstrapStageTimeout) }
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(n))
+
 			n = ExpectNodeExists(ctx, env.Client, n.Name)
 			Expect(n.DeletionTimestamp.IsZero()).To(BeFalse())
 		})
@@ -304,6 +559,21 @@ var _ = Describe("Controller", func() {
 			node = ExpectNodeExists(ctx, env.Client, node.Name)
 			Expect(node.DeletionTimestamp.IsZero()).To(BeFalse())
 		})
+		It("should not delete empty nodes past their TTL in read-only mode", func() {
+			provisioner.Spec.TTLSecondsAfterEmpty = ptr.Int64(30)
+			node := test.Node(test.NodeOptions{
+				Finalizers: []string{v1alpha5.TerminationFinalizer},
+				Labels:     map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Annotations: map[string]string{
+					v1alpha5.EmptinessTimestampAnnotationKey: time.Now().Add(-100 * time.Second).Format(time.RFC3339),
+				},
+			})
+			ExpectCreated(ctx, env.Client, provisioner, node)
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(node))
+
+			node = ExpectNodeExists(ctx, env.Client, node.Name)
+			Expect(node.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
 	})
 	Context("Finalizer", func() {
 		It("should add the termination finalizer if missing", func() {
@@ -318,6 +588,15 @@ var _ = Describe("Controller", func() {
 			n = ExpectNodeExists(ctx, env.Client, n.Name)
 			Expect(n.Finalizers).To(ConsistOf(n.Finalizers[0], v1alpha5.TerminationFinalizer))
 		})
+		It("should not add the termination finalizer in read-only mode", func() {
+			n := test.Node(test.NodeOptions{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+			})
+			ExpectCreated(ctx, env.Client, provisioner, n)
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(n))
+			n = ExpectNodeExists(ctx, env.Client, n.Name)
+			Expect(n.Finalizers).ToNot(ContainElement(v1alpha5.TerminationFinalizer))
+		})
 		It("should do nothing if terminating", func() {
 			n := test.Node(test.NodeOptions{
 				Labels:     map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
@@ -356,3 +635,33 @@ var _ = Describe("Controller", func() {
 		})
 	})
 })
+
+// counterValue returns the value of the counter for the provisioner gathered from the registry.
+func counterValue(name string, provisioner string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == metrics.ProvisionerLabel && label.GetValue() == provisioner {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// fakeLiveness records the nodes it reconciles and returns a fixed result
+type fakeLiveness struct {
+	result     reconcile.Result
+	reconciled []string
+}
+
+func (f *fakeLiveness) Reconcile(_ context.Context, _ *v1alpha5.Provisioner, n *v1.Node) (reconcile.Result, error) {
+	f.reconciled = append(f.reconciled, n.Name)
+	return f.result, nil
+}
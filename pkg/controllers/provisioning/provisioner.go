@@ -17,6 +17,7 @@ package provisioning
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -201,6 +202,11 @@ func (p *Provisioner) launch(ctx context.Context, constraints *v1alpha5.Constrai
 	}
 	return p.cloudProvider.Create(ctx, constraints, packing.InstanceTypeOptions, packing.NodeQuantity, func(node *v1.Node) error {
 		node.Labels = functional.UnionStringMaps(node.Labels, constraints.Labels)
+		// The generation label is applied to the node rather than the constraints
+		// so that it is never a scheduling requirement.
+		if injection.GetOptions(ctx).MetricsProvisionerGeneration {
+			node.Labels[v1alpha5.ProvisionerGenerationLabelKey] = strconv.FormatInt(p.Generation, 10)
+		}
 		node.Spec.Taints = append(node.Spec.Taints, constraints.Taints...)
 		return p.bind(ctx, node, <-pods)
 	})
@@ -16,6 +16,7 @@ package provisioning_test
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
@@ -24,6 +25,8 @@ import (
 	"github.com/aws/karpenter/pkg/controllers/provisioning"
 	"github.com/aws/karpenter/pkg/controllers/selection"
 	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
 	"github.com/aws/karpenter/pkg/utils/resources"
 
 	v1 "k8s.io/api/core/v1"
@@ -130,6 +133,16 @@ var _ = Describe("Provisioning", func() {
 				ExpectNotScheduled(ctx, env.Client, pod)
 			}
 		})
+		It("should label nodes with the provisioner generation if enabled", func() {
+			pod := ExpectProvisioned(injection.WithOptions(ctx, options.Options{MetricsProvisionerGeneration: true}), env.Client, selectionController, provisioningController, provisioner, test.UnschedulablePod())[0]
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1alpha5.ProvisionerGenerationLabelKey, strconv.FormatInt(provisioner.Generation, 10)))
+		})
+		It("should not label nodes with the provisioner generation by default", func() {
+			pod := ExpectProvisioned(ctx, env.Client, selectionController, provisioningController, provisioner, test.UnschedulablePod())[0]
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).ToNot(HaveKey(v1alpha5.ProvisionerGenerationLabelKey))
+		})
 		It("should provision nodes for accelerators", func() {
 			for _, pod := range ExpectProvisioned(ctx, env.Client, selectionController, provisioningController, provisioner,
 				test.UnschedulablePod(test.PodOptions{
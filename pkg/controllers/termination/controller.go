@@ -77,6 +77,15 @@ func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	if node.DeletionTimestamp.IsZero() || !functional.ContainsString(node.Finalizers, provisioning.TerminationFinalizer) {
 		return reconcile.Result{}, nil
 	}
+	// In read-only mode, the node is neither drained nor terminated, but the
+	// finalizer is removed so the deletion is not blocked
+	if injection.GetOptions(ctx).ReadOnly {
+		logging.FromContext(ctx).Infof("Would cordon, drain, and terminate node, skipping in read-only mode")
+		if err := c.Terminator.removeFinalizer(ctx, node); err != nil {
+			return reconcile.Result{}, fmt.Errorf("removing finalizer from node %s, %w", node.Name, err)
+		}
+		return reconcile.Result{}, nil
+	}
 	// 3. Cordon node
 	if err := c.Terminator.cordon(ctx, node); err != nil {
 		return reconcile.Result{}, fmt.Errorf("cordoning node %s, %w", node.Name, err)
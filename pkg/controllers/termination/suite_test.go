@@ -28,6 +28,8 @@ import (
 	"github.com/aws/karpenter/pkg/test"
 	"github.com/aws/karpenter/pkg/utils/functional"
 	"github.com/aws/karpenter/pkg/utils/injectabletime"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	. "github.com/aws/karpenter/pkg/test/expectations"
@@ -93,6 +95,15 @@ var _ = Describe("Termination", func() {
 			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(node))
 			ExpectNotFound(ctx, env.Client, node)
 		})
+		It("should delete nodes without draining in read-only mode", func() {
+			pod := test.Pod(test.PodOptions{NodeName: node.Name})
+			ExpectCreated(ctx, env.Client, node, pod)
+			Expect(env.Client.Delete(ctx, node)).To(Succeed())
+			node = ExpectNodeExists(ctx, env.Client, node.Name)
+			ExpectReconcileSucceeded(injection.WithOptions(ctx, options.Options{ReadOnly: true}), controller, client.ObjectKeyFromObject(node))
+			ExpectNotFound(ctx, env.Client, node)
+			ExpectNotEnqueuedForEviction(evictionQueue, pod)
+		})
 		It("should not evict pods that tolerate unschedulable taint", func() {
 			podEvict := test.Pod(test.PodOptions{NodeName: node.Name})
 			podSkip := test.Pod(test.PodOptions{
@@ -87,6 +87,12 @@ func (t *Terminator) terminate(ctx context.Context, node *v1.Node) error {
 		return fmt.Errorf("terminating cloudprovider instance, %w", err)
 	}
 	// 2. Remove finalizer from node in APIServer
+	return t.removeFinalizer(ctx, node)
+}
+
+// removeFinalizer removes the termination finalizer from the node, allowing the
+// APIServer to delete it
+func (t *Terminator) removeFinalizer(ctx context.Context, node *v1.Node) error {
 	persisted := node.DeepCopy()
 	node.Finalizers = functional.StringSliceWithout(node.Finalizers, v1alpha5.TerminationFinalizer)
 	if err := t.KubeClient.Patch(ctx, node, client.MergeFrom(persisted)); err != nil {
@@ -0,0 +1,83 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/karpenter/pkg/utils/options"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultPath is the path the controller-runtime metrics server serves metrics on.
+const DefaultPath = "/metrics"
+
+// Handler serves the metrics registered with the controller-runtime registry,
+// adding the extra labels to every series.
+func Handler(extraLabels prometheus.Labels) http.Handler {
+	return promhttp.HandlerFor(WithExtraLabels(crmetrics.Registry, extraLabels), promhttp.HandlerOpts{ErrorHandling: promhttp.HTTPErrorOnError})
+}
+
+// Server serves the metrics handler with read and write timeouts, which the
+// controller-runtime metrics server does not support.
+type Server struct {
+	*http.Server
+}
+
+// NewServer returns a server for the metrics handler on the default path and,
+// if set, on a custom path.
+func NewServer(address string, path string, readTimeout time.Duration, writeTimeout time.Duration, extraLabels prometheus.Labels) *Server {
+	handler := Handler(extraLabels)
+	mux := http.NewServeMux()
+	mux.Handle(DefaultPath, handler)
+	if path != "" && path != DefaultPath {
+		mux.Handle(path, handler)
+	}
+	return &Server{Server: &http.Server{
+		Addr:         address,
+		Handler:      mux,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}}
+}
+
+// NewServerFromOptions returns a server for the metrics handler configured by
+// the metrics options, which is shared by the controller and webhook.
+func NewServerFromOptions(opts options.Options) *Server {
+	extraLabels, _ := opts.MetricsExtraLabelSet()
+	return NewServer(fmt.Sprintf(":%d", opts.MetricsPort), opts.MetricsPath, opts.MetricsReadTimeout, opts.MetricsWriteTimeout, extraLabels)
+}
+
+// Start serves metrics until the context is done.
+func (s *Server) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = s.Shutdown(context.Background())
+	}()
+	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false so metrics are served by every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,63 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"knative.dev/pkg/ptr"
+)
+
+// labeledGatherer adds a static set of labels to every series it gathers.
+type labeledGatherer struct {
+	prometheus.Gatherer
+	labels prometheus.Labels
+}
+
+// WithExtraLabels returns a gatherer that adds the labels to every series
+// gathered from the given gatherer. A series that already has one of the labels
+// keeps its own value.
+func WithExtraLabels(gatherer prometheus.Gatherer, labels prometheus.Labels) prometheus.Gatherer {
+	if len(labels) == 0 {
+		return gatherer
+	}
+	return &labeledGatherer{Gatherer: gatherer, labels: labels}
+}
+
+func (r *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := r.Gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = r.withLabels(metric.Label)
+		}
+	}
+	return families, err
+}
+
+func (r *labeledGatherer) withLabels(pairs []*dto.LabelPair) []*dto.LabelPair {
+	existing := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		existing[pair.GetName()] = true
+	}
+	for name, value := range r.labels {
+		if !existing[name] {
+			pairs = append(pairs, &dto.LabelPair{Name: ptr.String(name), Value: ptr.String(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
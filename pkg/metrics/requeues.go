@@ -0,0 +1,45 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const ControllerLabel = "controller"
+
+var requeuesCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "controller",
+		Name:      "requeues_total",
+		Help:      "Count of reconciles that were requeued, either explicitly or due to an error, by controller.",
+	},
+	[]string{ControllerLabel},
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(requeuesCounter)
+}
+
+// ObserveRequeue counts the reconcile of the controller if its result or error
+// causes it to be requeued.
+func ObserveRequeue(controller string, result reconcile.Result, err error) {
+	if err != nil || result.Requeue || result.RequeueAfter > 0 {
+		requeuesCounter.WithLabelValues(controller).Inc()
+	}
+}
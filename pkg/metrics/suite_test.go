@@ -0,0 +1,232 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/karpenter/pkg/metrics"
+	"github.com/aws/karpenter/pkg/utils/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	admissionv1 "k8s.io/api/admission/v1"
+	"knative.dev/pkg/webhook"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMetrics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics")
+}
+
+var _ = Describe("Extra Labels", func() {
+	var gaugeVec *prometheus.GaugeVec
+	var registry *prometheus.Registry
+
+	BeforeEach(func() {
+		gaugeVec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metrics.Namespace, Name: "test"}, []string{metrics.ProvisionerLabel})
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(gaugeVec)
+		gaugeVec.With(prometheus.Labels{metrics.ProvisionerLabel: "default"}).Set(1)
+	})
+
+	It("should add the extra labels to every series", func() {
+		families, err := metrics.WithExtraLabels(registry, prometheus.Labels{"cluster": "prod", "region": "us-east-1"}).Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].Metric).To(HaveLen(1))
+		Expect(labelsOf(families[0].Metric[0].Label...)).To(Equal(map[string]string{
+			"cluster":                "prod",
+			metrics.ProvisionerLabel: "default",
+			"region":                 "us-east-1",
+		}))
+	})
+	It("should not override labels already on a series", func() {
+		families, err := metrics.WithExtraLabels(registry, prometheus.Labels{metrics.ProvisionerLabel: "override"}).Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(labelsOf(families[0].Metric[0].Label...)).To(Equal(map[string]string{metrics.ProvisionerLabel: "default"}))
+	})
+	It("should return the gatherer unchanged without extra labels", func() {
+		Expect(metrics.WithExtraLabels(registry, nil)).To(BeIdenticalTo(registry))
+	})
+})
+
+var _ = Describe("Handler", func() {
+	It("should serve the registry on a custom path", func() {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: metrics.Namespace, Name: "handler_test"})
+		Expect(crmetrics.Registry.Register(gauge)).To(Succeed())
+		defer crmetrics.Registry.Unregister(gauge)
+
+		mux := http.NewServeMux()
+		mux.Handle("/karpenter/metrics", metrics.Handler(nil))
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		response, err := http.Get(server.URL + "/karpenter/metrics")
+		Expect(err).ToNot(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("karpenter_handler_test"))
+	})
+})
+
+var _ = Describe("Server", func() {
+	It("should serve the default and custom paths with timeouts", func() {
+		server := metrics.NewServer(":0", "/karpenter/metrics", time.Second, 2*time.Second, nil)
+		Expect(server.ReadTimeout).To(Equal(time.Second))
+		Expect(server.WriteTimeout).To(Equal(2 * time.Second))
+		Expect(server.NeedLeaderElection()).To(BeFalse())
+
+		testServer := httptest.NewServer(server.Handler)
+		defer testServer.Close()
+		for _, path := range []string{metrics.DefaultPath, "/karpenter/metrics"} {
+			response, err := http.Get(testServer.URL + path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Body.Close()).To(Succeed())
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+		}
+	})
+	It("should add the extra labels to served series without changing the registry", func() {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: metrics.Namespace, Name: "server_test"})
+		Expect(crmetrics.Registry.Register(gauge)).To(Succeed())
+		defer crmetrics.Registry.Unregister(gauge)
+
+		server := metrics.NewServer(":0", metrics.DefaultPath, time.Second, time.Second, prometheus.Labels{"cluster": "prod"})
+		testServer := httptest.NewServer(server.Handler)
+		defer testServer.Close()
+		response, err := http.Get(testServer.URL + metrics.DefaultPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`karpenter_server_test{cluster="prod"}`))
+
+		families, err := crmetrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				Expect(labelsOf(metric.Label...)).ToNot(HaveKey("cluster"))
+			}
+		}
+	})
+})
+
+var _ = Describe("Requeues", func() {
+	It("should count requeued reconciles", func() {
+		requeues := requeuesFor("test-controller")
+		metrics.ObserveRequeue("test-controller", reconcile.Result{RequeueAfter: time.Second}, nil)
+		Expect(requeuesFor("test-controller")).To(Equal(requeues + 1))
+		metrics.ObserveRequeue("test-controller", reconcile.Result{Requeue: true}, nil)
+		Expect(requeuesFor("test-controller")).To(Equal(requeues + 2))
+		metrics.ObserveRequeue("test-controller", reconcile.Result{}, fmt.Errorf("failed"))
+		Expect(requeuesFor("test-controller")).To(Equal(requeues + 3))
+	})
+	It("should not count reconciles that are not requeued", func() {
+		requeues := requeuesFor("test-controller")
+		metrics.ObserveRequeue("test-controller", reconcile.Result{}, nil)
+		Expect(requeuesFor("test-controller")).To(Equal(requeues))
+	})
+})
+
+var _ = Describe("Webhook", func() {
+	var delegate *fakeStatsReporter
+	var reporter webhook.StatsReporter
+
+	BeforeEach(func() {
+		delegate = &fakeStatsReporter{}
+		reporter = metrics.DecorateWebhookStatsReporter(delegate)
+	})
+
+	It("should count requests by operation and outcome", func() {
+		allowed := counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "create", metrics.OutcomeLabel: metrics.OutcomeAllowed})
+		rejected := counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "update", metrics.OutcomeLabel: metrics.OutcomeRejected})
+
+		Expect(reporter.ReportRequest(&admissionv1.AdmissionRequest{Operation: admissionv1.Create}, &admissionv1.AdmissionResponse{Allowed: true}, time.Millisecond)).To(Succeed())
+		Expect(reporter.ReportRequest(&admissionv1.AdmissionRequest{Operation: admissionv1.Update}, &admissionv1.AdmissionResponse{Allowed: false}, time.Millisecond)).To(Succeed())
+
+		Expect(counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "create", metrics.OutcomeLabel: metrics.OutcomeAllowed})).To(Equal(allowed + 1))
+		Expect(counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "update", metrics.OutcomeLabel: metrics.OutcomeRejected})).To(Equal(rejected + 1))
+		Expect(delegate.reported).To(Equal(2))
+	})
+	It("should serve request metrics with the extra labels", func() {
+		Expect(reporter.ReportRequest(&admissionv1.AdmissionRequest{Operation: admissionv1.Create}, &admissionv1.AdmissionResponse{Allowed: true}, time.Millisecond)).To(Succeed())
+		server := metrics.NewServerFromOptions(options.Options{MetricsPath: "/karpenter/metrics", MetricsExtraLabels: "cluster=prod"})
+		testServer := httptest.NewServer(server.Handler)
+		defer testServer.Close()
+
+		response, err := http.Get(testServer.URL + "/karpenter/metrics")
+		Expect(err).ToNot(HaveOccurred())
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`karpenter_webhook_requests_total{cluster="prod",operation="create",outcome="allowed"}`))
+		Expect(string(body)).To(ContainSubstring(`karpenter_webhook_request_duration_seconds_count{cluster="prod",operation="create",outcome="allowed"}`))
+	})
+	It("should record an error outcome without a response", func() {
+		errored := counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "delete", metrics.OutcomeLabel: metrics.OutcomeError})
+		Expect(reporter.ReportRequest(&admissionv1.AdmissionRequest{Operation: admissionv1.Delete}, nil, time.Millisecond)).To(Succeed())
+		Expect(counterFor("karpenter_webhook_requests_total", map[string]string{metrics.OperationLabel: "delete", metrics.OutcomeLabel: metrics.OutcomeError})).To(Equal(errored + 1))
+	})
+})
+
+type fakeStatsReporter struct {
+	reported int
+}
+
+func (f *fakeStatsReporter) ReportRequest(*admissionv1.AdmissionRequest, *admissionv1.AdmissionResponse, time.Duration) error {
+	f.reported++
+	return nil
+}
+
+// requeuesFor returns the requeue count of the controller gathered from the registry.
+func requeuesFor(controller string) float64 {
+	return counterFor("karpenter_controller_requeues_total", map[string]string{metrics.ControllerLabel: controller})
+}
+
+// counterFor returns the value of the counter with the labels gathered from the registry.
+func counterFor(name string, labels map[string]string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.Metric {
+			if reflect.DeepEqual(labelsOf(metric.Label...), labels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func labelsOf(pairs ...*dto.LabelPair) map[string]string {
+	labels := map[string]string{}
+	for _, pair := range pairs {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
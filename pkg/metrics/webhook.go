@@ -0,0 +1,92 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"knative.dev/pkg/webhook"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	OperationLabel = "operation"
+	OutcomeLabel   = "outcome"
+
+	OutcomeAllowed  = "allowed"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+)
+
+var (
+	webhookRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of webhook admission requests by operation and outcome.",
+			Buckets:   DurationBuckets(),
+		},
+		[]string{OperationLabel, OutcomeLabel},
+	)
+	webhookRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "requests_total",
+			Help:      "Count of webhook admission requests by operation and outcome.",
+		},
+		[]string{OperationLabel, OutcomeLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(webhookRequestDuration)
+	crmetrics.Registry.MustRegister(webhookRequests)
+}
+
+type webhookStatsReporter struct {
+	webhook.StatsReporter
+}
+
+// DecorateWebhookStatsReporter returns a StatsReporter that records webhook
+// admission requests in the controller-runtime registry and then delegates to
+// the argument, `reporter`.
+func DecorateWebhookStatsReporter(reporter webhook.StatsReporter) webhook.StatsReporter {
+	return &webhookStatsReporter{StatsReporter: reporter}
+}
+
+func (r *webhookStatsReporter) ReportRequest(request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse, duration time.Duration) error {
+	labels := prometheus.Labels{
+		OperationLabel: strings.ToLower(string(request.Operation)),
+		OutcomeLabel:   outcomeOf(response),
+	}
+	webhookRequestDuration.With(labels).Observe(duration.Seconds())
+	webhookRequests.With(labels).Inc()
+	return r.StatsReporter.ReportRequest(request, response, duration)
+}
+
+func outcomeOf(response *admissionv1.AdmissionResponse) string {
+	if response == nil {
+		return OutcomeError
+	}
+	if response.Allowed {
+		return OutcomeAllowed
+	}
+	return OutcomeRejected
+}
@@ -15,7 +15,16 @@ limitations under the License.
 package node
 
 import (
+	"context"
+
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"github.com/aws/karpenter/pkg/utils/injection"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 func IsReady(node *v1.Node) bool {
@@ -30,3 +39,52 @@ func GetCondition(conditions []v1.NodeCondition, match v1.NodeConditionType) v1.
 	}
 	return v1.NodeCondition{}
 }
+
+// GetProvisionerLabelKey returns the node label key that identifies a node's
+// provisioner, which may be overridden for distributions that rename it.
+func GetProvisionerLabelKey(ctx context.Context) string {
+	if key := injection.GetOptions(ctx).ProvisionerLabelKey; key != "" {
+		return key
+	}
+	return v1alpha5.ProvisionerNameLabelKey
+}
+
+// IsManaged returns true if the node was provisioned by Karpenter
+func IsManaged(ctx context.Context, node client.Object) bool {
+	_, ok := node.GetLabels()[GetProvisionerLabelKey(ctx)]
+	return ok
+}
+
+// ManagedPredicate filters watch events to nodes provisioned by Karpenter
+func ManagedPredicate(ctx context.Context) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(node client.Object) bool {
+		return IsManaged(ctx, node)
+	})
+}
+
+// IgnoreHeartbeatsPredicate filters update events where only the heartbeat
+// times of the node's conditions changed
+func IgnoreHeartbeatsPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, oldOK := e.ObjectOld.(*v1.Node)
+			newNode, newOK := e.ObjectNew.(*v1.Node)
+			if !oldOK || !newOK {
+				return true
+			}
+			return !equality.Semantic.DeepEqual(withoutHeartbeats(oldNode), withoutHeartbeats(newNode))
+		},
+	}
+}
+
+// withoutHeartbeats returns a copy of the node without the fields that change
+// on every heartbeat
+func withoutHeartbeats(node *v1.Node) *v1.Node {
+	node = node.DeepCopy()
+	node.ResourceVersion = ""
+	node.ManagedFields = nil
+	for i := range node.Status.Conditions {
+		node.Status.Conditions[i].LastHeartbeatTime = metav1.Time{}
+	}
+	return node
+}
@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
+	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/injection"
+	"github.com/aws/karpenter/pkg/utils/options"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestNode(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Node Utils")
+}
+
+var _ = Describe("ManagedPredicate", func() {
+	ctx := context.Background()
+	managed := test.Node(test.NodeOptions{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: "default"}})
+	unmanaged := test.Node()
+
+	It("should allow events for managed nodes", func() {
+		Expect(ManagedPredicate(ctx).Create(event.CreateEvent{Object: managed})).To(BeTrue())
+		Expect(ManagedPredicate(ctx).Update(event.UpdateEvent{ObjectOld: managed, ObjectNew: managed})).To(BeTrue())
+		Expect(ManagedPredicate(ctx).Delete(event.DeleteEvent{Object: managed})).To(BeTrue())
+		Expect(ManagedPredicate(ctx).Generic(event.GenericEvent{Object: managed})).To(BeTrue())
+	})
+	It("should filter events for unmanaged nodes", func() {
+		Expect(ManagedPredicate(ctx).Create(event.CreateEvent{Object: unmanaged})).To(BeFalse())
+		Expect(ManagedPredicate(ctx).Update(event.UpdateEvent{ObjectOld: unmanaged, ObjectNew: unmanaged})).To(BeFalse())
+		Expect(ManagedPredicate(ctx).Delete(event.DeleteEvent{Object: unmanaged})).To(BeFalse())
+		Expect(ManagedPredicate(ctx).Generic(event.GenericEvent{Object: unmanaged})).To(BeFalse())
+	})
+	It("should identify managed nodes by the provisioner label key from options", func() {
+		customCtx := injection.WithOptions(ctx, options.Options{ProvisionerLabelKey: "example.com/provisioner-name"})
+		custom := test.Node(test.NodeOptions{Labels: map[string]string{"example.com/provisioner-name": "default"}})
+		Expect(ManagedPredicate(customCtx).Create(event.CreateEvent{Object: custom})).To(BeTrue())
+		Expect(ManagedPredicate(customCtx).Create(event.CreateEvent{Object: managed})).To(BeFalse())
+	})
+	It("should default the provisioner label key", func() {
+		Expect(GetProvisionerLabelKey(ctx)).To(Equal(v1alpha5.ProvisionerNameLabelKey))
+		customCtx := injection.WithOptions(ctx, options.Options{ProvisionerLabelKey: "example.com/provisioner-name"})
+		Expect(GetProvisionerLabelKey(customCtx)).To(Equal("example.com/provisioner-name"))
+	})
+})
+
+var _ = Describe("IgnoreHeartbeatsPredicate", func() {
+	var old *v1.Node
+	BeforeEach(func() {
+		old = test.Node(test.NodeOptions{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}})
+		old.ResourceVersion = "1"
+	})
+
+	It("should filter heartbeat only updates", func() {
+		updated := old.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Now().Add(time.Minute))
+		Expect(IgnoreHeartbeatsPredicate().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated})).To(BeFalse())
+	})
+	It("should allow capacity changes", func() {
+		updated := old.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Now().Add(time.Minute))
+		updated.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("2")
+		Expect(IgnoreHeartbeatsPredicate().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated})).To(BeTrue())
+	})
+	It("should allow readiness changes", func() {
+		updated := old.DeepCopy()
+		updated.Status.Conditions[0].Status = v1.ConditionFalse
+		Expect(IgnoreHeartbeatsPredicate().Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated})).To(BeTrue())
+	})
+	It("should allow other events", func() {
+		Expect(IgnoreHeartbeatsPredicate().Create(event.CreateEvent{Object: old})).To(BeTrue())
+		Expect(IgnoreHeartbeatsPredicate().Delete(event.DeleteEvent{Object: old})).To(BeTrue())
+	})
+})
@@ -15,24 +15,43 @@ limitations under the License.
 package options
 
 import (
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/aws/karpenter/pkg/apis/provisioning/v1alpha5"
 	"github.com/aws/karpenter/pkg/utils/env"
 	"go.uber.org/multierr"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
 )
 
+const endpointReachabilityTimeout = 5 * time.Second
+
+// maxRecommendedKubeClientQPS is the kube-client-qps above which a warning is
+// logged, as higher rates risk overwhelming the kube-apiserver.
+const maxRecommendedKubeClientQPS = 1000
+
+// DefaultInterruptionTaintKey is the taint aws-node-termination-handler applies
+// to nodes with an imminent spot interruption.
+const DefaultInterruptionTaintKey = "aws-node-termination-handler/spot-itn"
+
+// lookupHost resolves endpoint hostnames, and is replaced in tests.
+var lookupHost = net.LookupHost
+
+var metricLabelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
 func MustParse() Options {
 	opts := Options{}
-	flag.StringVar(&opts.ClusterName, "cluster-name", env.WithDefaultString("CLUSTER_NAME", ""), "The kubernetes cluster name for resource discovery")
-	flag.StringVar(&opts.ClusterEndpoint, "cluster-endpoint", env.WithDefaultString("CLUSTER_ENDPOINT", ""), "The external kubernetes cluster endpoint for new nodes to connect with")
-	flag.IntVar(&opts.MetricsPort, "metrics-port", env.WithDefaultInt("METRICS_PORT", 8080), "The port the metric endpoint binds to for operating metrics about the controller itself")
-	flag.IntVar(&opts.HealthProbePort, "health-probe-port", env.WithDefaultInt("HEALTH_PROBE_PORT", 8081), "The port the health probe endpoint binds to for reporting controller health")
-	flag.IntVar(&opts.WebhookPort, "port", 8443, "The port the webhook endpoint binds to for validation and mutation of resources")
-	flag.IntVar(&opts.KubeClientQPS, "kube-client-qps", env.WithDefaultInt("KUBE_CLIENT_QPS", 200), "The smoothed rate of qps to kube-apiserver")
-	flag.IntVar(&opts.KubeClientBurst, "kube-client-burst", env.WithDefaultInt("KUBE_CLIENT_BURST", 300), "The maximum allowed burst of queries to the kube-apiserver")
-	flag.StringVar(&opts.AWSNodeNameConvention, "aws-node-name-convention", env.WithDefaultString("AWS_NODE_NAME_CONVENTION", "ip-name"), "The node naming convention used by the AWS cloud provider. DEPRECATION WARNING: this field may be deprecated at any time")
+	opts.AddFlags(flag.CommandLine)
 	flag.Parse()
 	if err := opts.Validate(); err != nil {
 		panic(err)
@@ -40,35 +59,329 @@ func MustParse() Options {
 	return opts
 }
 
+// AddFlags registers the options as flags on the flag set, defaulting each from
+// its environment variable.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ClusterName, "cluster-name", env.WithDefaultString("CLUSTER_NAME", ""), "The kubernetes cluster name for resource discovery")
+	fs.StringVar(&o.ClusterEndpoint, "cluster-endpoint", env.WithDefaultString("CLUSTER_ENDPOINT", ""), "The external kubernetes cluster endpoint for new nodes to connect with")
+	fs.StringVar(&o.Namespace, "namespace", env.WithDefaultString("POD_NAMESPACE", env.WithDefaultString("SYSTEM_NAMESPACE", "")), "The namespace Karpenter runs in, used for leader election and loading configuration")
+	fs.IntVar(&o.MetricsPort, "metrics-port", env.WithDefaultInt("METRICS_PORT", 8080), "The port the metric endpoint binds to for operating metrics about the controller itself")
+	fs.IntVar(&o.HealthProbePort, "health-probe-port", env.WithDefaultInt("HEALTH_PROBE_PORT", 8081), "The port the health probe endpoint binds to for reporting controller health")
+	fs.IntVar(&o.WebhookPort, "port", 8443, "The port the webhook endpoint binds to for validation and mutation of resources")
+	fs.IntVar(&o.KubeClientQPS, "kube-client-qps", env.WithDefaultInt("KUBE_CLIENT_QPS", 200), "The smoothed rate of qps to kube-apiserver")
+	fs.IntVar(&o.KubeClientBurst, "kube-client-burst", env.WithDefaultInt("KUBE_CLIENT_BURST", 300), "The maximum allowed burst of queries to the kube-apiserver")
+	fs.StringVar(&o.AWSNodeNameConvention, "aws-node-name-convention", env.WithDefaultString("AWS_NODE_NAME_CONVENTION", "ip-name"), "The node naming convention used by the AWS cloud provider. DEPRECATION WARNING: this field may be deprecated at any time")
+	fs.IntVar(&o.AWSTagCountWarningThreshold, "aws-tag-count-warning-threshold", env.WithDefaultInt("AWS_TAG_COUNT_WARNING_THRESHOLD", 40), "The number of provider tags above which a warning is logged, leaving room for tags applied by Karpenter. Set to 0 to disable")
+	fs.StringVar(&o.ProvisionerLabelKey, "provisioner-label-key", env.WithDefaultString("PROVISIONER_LABEL_KEY", v1alpha5.ProvisionerNameLabelKey), "The node label key used by the node and metrics controllers to identify a node's provisioner")
+	fs.IntVar(&o.MetricsReconcileConcurrency, "metrics-reconcile-concurrency", env.WithDefaultInt("METRICS_RECONCILE_CONCURRENCY", 10), "The maximum number of concurrent reconciles for the metrics controller")
+	fs.StringVar(&o.MetricsPath, "metrics-path", env.WithDefaultString("METRICS_PATH", "/metrics"), "The path to serve metrics on, in addition to /metrics")
+	fs.DurationVar(&o.MetricsReadTimeout, "metrics-read-timeout", env.WithDefaultDuration("METRICS_READ_TIMEOUT", 30*time.Second), "The maximum duration for the metrics server to read a request")
+	fs.DurationVar(&o.MetricsWriteTimeout, "metrics-write-timeout", env.WithDefaultDuration("METRICS_WRITE_TIMEOUT", 30*time.Second), "The maximum duration for the metrics server to write a response")
+	fs.StringVar(&o.MetricsExtraLabels, "metrics-extra-labels", env.WithDefaultString("METRICS_EXTRA_LABELS", ""), "Comma separated key=value labels added to every emitted metric, e.g. cluster=prod,region=us-east-1")
+	fs.StringVar(&o.MetricsProvisionerAllowlist, "metrics-provisioner-allowlist", env.WithDefaultString("METRICS_PROVISIONER_ALLOWLIST", ""), "Comma separated names of the provisioners to publish metrics for. If empty, metrics are published for all provisioners")
+	fs.BoolVar(&o.MetricsProvisionerGeneration, "metrics-provisioner-generation", env.WithDefaultBool("METRICS_PROVISIONER_GENERATION", false), "If true, publish node counts by the provisioner generation the nodes were created under, with a series per generation in use")
+	fs.BoolVar(&o.MetricsPodRestartsByPod, "metrics-pod-restarts-by-pod", env.WithDefaultBool("METRICS_POD_RESTARTS_BY_POD", false), "If true, publish the container restart count of each pod, with a series per pod")
+	fs.BoolVar(&o.MetricsNodeInstanceInfo, "metrics-node-instance-info", env.WithDefaultBool("METRICS_NODE_INSTANCE_INFO", false), "If true, publish the instance ID of each node, with a series per node")
+	fs.BoolVar(&o.MetricsRequireNodeLabels, "metrics-require-node-labels", env.WithDefaultBool("METRICS_REQUIRE_NODE_LABELS", false), "If true, wait until a provisioner's nodes have arch, instance type, and zone labels before publishing its metrics, so series are not republished once nodes are labeled")
+	fs.BoolVar(&o.NodeMetricsIncludeConditionMessage, "node-metrics-include-condition-message", env.WithDefaultBool("NODE_METRICS_INCLUDE_CONDITION_MESSAGE", false), "If true, label the node readiness metric with the message of the ready condition. Messages are high cardinality")
+	fs.StringVar(&o.InterruptionTaintKey, "interruption-taint-key", env.WithDefaultString("INTERRUPTION_TAINT_KEY", DefaultInterruptionTaintKey), "The node taint key that signals an imminent interruption, published by the metrics controller")
+	fs.StringVar(&o.BootstrapErrorConditionType, "bootstrap-error-condition-type", env.WithDefaultString("BOOTSTRAP_ERROR_CONDITION_TYPE", ""), "The node condition type that signals a bootstrap failure when True, published by the metrics controller. If empty, bootstrap errors are not published")
+	fs.Float64Var(&o.ConsolidationUtilizationThreshold, "consolidation-utilization-threshold", env.WithDefaultFloat64("CONSOLIDATION_UTILIZATION_THRESHOLD", 0), "The fraction of requested CPU or memory below which a node is published as a consolidation candidate, with a series per node. Disabled if 0")
+	fs.DurationVar(&o.ReconcileBaseDelay, "reconcile-base-delay", env.WithDefaultDuration("RECONCILE_BASE_DELAY", 5*time.Millisecond), "The initial delay before requeuing a failed reconcile of the metrics and node controllers, doubled on each failure")
+	fs.DurationVar(&o.ReconcileMaxDelay, "reconcile-max-delay", env.WithDefaultDuration("RECONCILE_MAX_DELAY", 1000*time.Second), "The maximum delay before requeuing a failed reconcile of the metrics and node controllers")
+	fs.DurationVar(&o.StuckTerminatingThreshold, "stuck-terminating-threshold", env.WithDefaultDuration("STUCK_TERMINATING_THRESHOLD", 0), "The duration a node may be deleting before the metrics controller publishes it as stuck terminating. Disabled if 0")
+	fs.DurationVar(&o.ResyncPeriod, "resync-period", env.WithDefaultDuration("RESYNC_PERIOD", 0), "The minimum frequency at which watched resources are reconciled. Set to 0 to use the controller-runtime default")
+	fs.StringVar(&o.PodMetricsSelector, "pod-metrics-selector", env.WithDefaultString("POD_METRICS_SELECTOR", ""), "A label selector restricting the pods included in pod metrics. If empty, all pods are included")
+	fs.BoolVar(&o.PodMetricsIncludeTerminal, "pod-metrics-include-terminal", env.WithDefaultBool("POD_METRICS_INCLUDE_TERMINAL", true), "If false, exclude Succeeded and Failed pods from per workload pod metrics")
+	fs.BoolVar(&o.ReadOnly, "read-only", env.WithDefaultBool("READ_ONLY", false), "If true, compute and expose metrics without mutating cluster state: nodes are not provisioned, updated, or terminated")
+	fs.BoolVar(&o.ReapNotReadyNodes, "reap-not-ready-nodes", env.WithDefaultBool("REAP_NOT_READY_NODES", false), "If true, delete nodes that have been NotReady for longer than the liveness timeout, even if they were once Ready")
+	fs.BoolVar(&o.ValidateEndpointDNS, "validate-endpoint-dns", env.WithDefaultBool("VALIDATE_ENDPOINT_DNS", false), "If true, fail validation when the cluster endpoint host does not resolve")
+	fs.BoolVar(&o.ValidateEndpointReachability, "validate-endpoint-reachability", env.WithDefaultBool("VALIDATE_ENDPOINT_REACHABILITY", false), "If true, fail validation when the cluster endpoint cannot be dialed")
+}
+
 // Options for running this binary
 type Options struct {
-	ClusterName           string
-	ClusterEndpoint       string
-	MetricsPort           int
-	HealthProbePort       int
-	WebhookPort           int
-	KubeClientQPS         int
-	KubeClientBurst       int
-	AWSNodeNameConvention string
+	ClusterName                        string
+	ClusterEndpoint                    string
+	Namespace                          string
+	MetricsPort                        int
+	HealthProbePort                    int
+	WebhookPort                        int
+	KubeClientQPS                      int
+	KubeClientBurst                    int
+	AWSNodeNameConvention              string
+	AWSTagCountWarningThreshold        int
+	ProvisionerLabelKey                string
+	PodMetricsSelector                 string
+	PodMetricsIncludeTerminal          bool
+	MetricsReconcileConcurrency        int
+	MetricsExtraLabels                 string
+	MetricsPath                        string
+	MetricsReadTimeout                 time.Duration
+	MetricsWriteTimeout                time.Duration
+	MetricsProvisionerAllowlist        string
+	MetricsProvisionerGeneration       bool
+	MetricsNodeInstanceInfo            bool
+	MetricsPodRestartsByPod            bool
+	MetricsRequireNodeLabels           bool
+	NodeMetricsIncludeConditionMessage bool
+	InterruptionTaintKey               string
+	BootstrapErrorConditionType        string
+	ConsolidationUtilizationThreshold  float64
+	ReconcileBaseDelay                 time.Duration
+	ReconcileMaxDelay                  time.Duration
+	ResyncPeriod                       time.Duration
+	StuckTerminatingThreshold          time.Duration
+	ValidateEndpointDNS                bool
+	ValidateEndpointReachability       bool
+	ReadOnly                           bool
+	ReapNotReadyNodes                  bool
 }
 
 func (o Options) Validate() (err error) {
-	err = multierr.Append(err, o.validateEndpoint())
+	if endpointErr := o.validateEndpoint(); endpointErr != nil {
+		err = multierr.Append(err, endpointErr)
+	} else {
+		err = multierr.Append(err, o.validateEndpointResolution())
+		err = multierr.Append(err, o.validateEndpointReachability())
+	}
+	err = multierr.Append(err, o.validatePorts())
+	err = multierr.Append(err, o.validateKubeClient())
+	if _, selectorErr := labels.Parse(o.PodMetricsSelector); selectorErr != nil {
+		err = multierr.Append(err, fmt.Errorf("pod-metrics-selector \"%s\" is not a valid label selector, %w", o.PodMetricsSelector, selectorErr))
+	}
 	if o.ClusterName == "" {
 		err = multierr.Append(err, fmt.Errorf("CLUSTER_NAME is required"))
 	}
+	// Leader election and the logging ConfigMap are always enabled and are
+	// scoped to the namespace
+	if o.Namespace == "" {
+		err = multierr.Append(err, fmt.Errorf("namespace is required for leader election and loading configuration, set it with --namespace, POD_NAMESPACE, or SYSTEM_NAMESPACE"))
+	}
 	if o.AWSNodeNameConvention != "ip-name" && o.AWSNodeNameConvention != "resource-name" {
 		err = multierr.Append(err, fmt.Errorf("aws-node-name-convention may only be either ip-name or resource-name"))
 	}
+	if o.MetricsPath != "" && !strings.HasPrefix(o.MetricsPath, "/") {
+		err = multierr.Append(err, fmt.Errorf("metrics-path \"%s\" must start with /", o.MetricsPath))
+	}
+	if _, extraLabelsErr := o.MetricsExtraLabelSet(); extraLabelsErr != nil {
+		err = multierr.Append(err, extraLabelsErr)
+	}
+	if o.MetricsReconcileConcurrency < 1 {
+		err = multierr.Append(err, fmt.Errorf("metrics-reconcile-concurrency must be at least 1"))
+	}
+	if o.ConsolidationUtilizationThreshold < 0 || o.ConsolidationUtilizationThreshold > 1 {
+		err = multierr.Append(err, fmt.Errorf("consolidation-utilization-threshold must be between 0 and 1"))
+	}
+	if o.ReconcileBaseDelay < 0 || o.ReconcileMaxDelay < 0 {
+		err = multierr.Append(err, fmt.Errorf("reconcile-base-delay and reconcile-max-delay cannot be negative"))
+	}
+	if o.ReconcileBaseDelay > o.ReconcileMaxDelay {
+		err = multierr.Append(err, fmt.Errorf("reconcile-base-delay cannot exceed reconcile-max-delay"))
+	}
+	if o.MetricsReadTimeout <= 0 || o.MetricsWriteTimeout <= 0 {
+		err = multierr.Append(err, fmt.Errorf("metrics-read-timeout and metrics-write-timeout must be positive"))
+	}
+	if o.ResyncPeriod < 0 || o.StuckTerminatingThreshold < 0 {
+		err = multierr.Append(err, fmt.Errorf("resync-period and stuck-terminating-threshold cannot be negative"))
+	}
+	if o.AWSTagCountWarningThreshold < 0 {
+		err = multierr.Append(err, fmt.Errorf("aws-tag-count-warning-threshold cannot be negative"))
+	}
 	return err
 }
 
 func (o Options) validateEndpoint() error {
-	endpoint, err := url.Parse(o.ClusterEndpoint)
-	// url.Parse() will accept a lot of input without error; make
-	// sure it's a real URL
-	if err != nil || !endpoint.IsAbs() || endpoint.Hostname() == "" {
-		return fmt.Errorf("\"%s\" not a valid CLUSTER_ENDPOINT URL", o.ClusterEndpoint)
+	for _, rawEndpoint := range strings.Split(o.ClusterEndpoint, ",") {
+		endpoint, err := url.Parse(strings.TrimSpace(rawEndpoint))
+		// url.Parse() will accept a lot of input without error; make
+		// sure it's a real URL
+		if err != nil || !endpoint.IsAbs() || endpoint.Hostname() == "" {
+			return fmt.Errorf("\"%s\" not a valid CLUSTER_ENDPOINT URL", rawEndpoint)
+		}
 	}
 	return nil
 }
+
+// validateEndpointResolution fails if the hostname of any cluster endpoint does
+// not exist. Other lookup failures may be transient and are not fatal.
+func (o Options) validateEndpointResolution() (err error) {
+	if !o.ValidateEndpointDNS {
+		return nil
+	}
+	for _, endpoint := range o.Endpoints() {
+		var dnsErr *net.DNSError
+		if _, lookupErr := lookupHost(endpoint.Hostname()); errors.As(lookupErr, &dnsErr) && dnsErr.IsNotFound {
+			err = multierr.Append(err, fmt.Errorf("CLUSTER_ENDPOINT host \"%s\" does not resolve, %w", endpoint.Hostname(), lookupErr))
+		}
+	}
+	return err
+}
+
+// validateEndpointReachability succeeds if any of the cluster endpoints can be
+// dialed, completing a TLS handshake for https endpoints.
+func (o Options) validateEndpointReachability() (err error) {
+	if !o.ValidateEndpointReachability {
+		return nil
+	}
+	for _, endpoint := range o.Endpoints() {
+		dialErr := dial(endpoint)
+		if dialErr == nil {
+			return nil
+		}
+		err = multierr.Append(err, dialErr)
+	}
+	return err
+}
+
+func dial(endpoint *url.URL) error {
+	port := endpoint.Port()
+	if port == "" {
+		port = "443"
+		if endpoint.Scheme == "http" {
+			port = "80"
+		}
+	}
+	address := net.JoinHostPort(endpoint.Hostname(), port)
+	var conn net.Conn
+	var err error
+	if endpoint.Scheme == "http" {
+		conn, err = net.DialTimeout("tcp", address, endpointReachabilityTimeout)
+	} else {
+		// The cluster CA is not known here, so the handshake only checks that the
+		// endpoint serves TLS and leaves verification to the client.
+		//nolint:gosec
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: endpointReachabilityTimeout}, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	}
+	if err != nil {
+		return fmt.Errorf("CLUSTER_ENDPOINT \"%s\" is not reachable, %w", endpoint, err)
+	}
+	return conn.Close()
+}
+
+// Endpoints returns the cluster endpoints, which may be given as a comma
+// separated list. Endpoints that cannot be parsed are omitted.
+func (o Options) Endpoints() (endpoints []*url.URL) {
+	for _, rawEndpoint := range strings.Split(o.ClusterEndpoint, ",") {
+		if endpoint, err := url.Parse(strings.TrimSpace(rawEndpoint)); err == nil {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+type port struct {
+	name  string
+	value int
+}
+
+func (o Options) ports() []port {
+	return []port{
+		{"webhook-port", o.WebhookPort},
+		{"metrics-port", o.MetricsPort},
+		{"health-probe-port", o.HealthProbePort},
+	}
+}
+
+// Warnings returns problems with the options that do not fail validation but
+// are likely to cause failures at runtime or load on the kube-apiserver.
+func (o Options) Warnings() (warnings []string) {
+	for _, port := range o.ports() {
+		if port.value > 0 && port.value < 1024 {
+			warnings = append(warnings, fmt.Sprintf("%s %d is privileged, binding to it requires elevated privileges", port.name, port.value))
+		}
+	}
+	if o.KubeClientQPS > maxRecommendedKubeClientQPS {
+		warnings = append(warnings, fmt.Sprintf("kube-client-qps %d exceeds %d and may overwhelm the kube-apiserver", o.KubeClientQPS, maxRecommendedKubeClientQPS))
+	}
+	return warnings
+}
+
+func (o Options) validatePorts() (err error) {
+	ports := map[int]string{}
+	for _, port := range o.ports() {
+		// Port 0 binds to an ephemeral port and never conflicts
+		if port.value == 0 {
+			continue
+		}
+		if existing, ok := ports[port.value]; ok {
+			err = multierr.Append(err, fmt.Errorf("%s and %s must be distinct, both are set to %d", existing, port.name, port.value))
+			continue
+		}
+		ports[port.value] = port.name
+	}
+	return err
+}
+
+func (o Options) validateKubeClient() (err error) {
+	if o.KubeClientBurst < o.KubeClientQPS {
+		err = multierr.Append(err, fmt.Errorf("kube-client-burst %d cannot be less than kube-client-qps %d", o.KubeClientBurst, o.KubeClientQPS))
+	}
+	return err
+}
+
+// ReconcileRateLimiter returns a rate limiter that requeues failed reconciles
+// with exponential backoff between the base and max delays, and otherwise
+// matches the controller-runtime default. If either delay is unset, the
+// controller-runtime default is returned.
+func (o Options) ReconcileRateLimiter() workqueue.RateLimiter {
+	if o.ReconcileBaseDelay == 0 || o.ReconcileMaxDelay == 0 {
+		return workqueue.DefaultControllerRateLimiter()
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(o.ReconcileBaseDelay, o.ReconcileMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// SyncPeriod returns the resync period for the manager's cache, or nil to use
+// the controller-runtime default if it is unset.
+func (o Options) SyncPeriod() *time.Duration {
+	if o.ResyncPeriod == 0 {
+		return nil
+	}
+	syncPeriod := o.ResyncPeriod
+	return &syncPeriod
+}
+
+// MetricsProvisionerAllowed returns true if metrics are published for the
+// provisioner, which is any provisioner if the allowlist is empty.
+func (o Options) MetricsProvisionerAllowed(provisioner string) bool {
+	if strings.TrimSpace(o.MetricsProvisionerAllowlist) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(o.MetricsProvisionerAllowlist, ",") {
+		if strings.TrimSpace(allowed) == provisioner {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricsExtraLabelSet parses the comma separated key=value pairs of the
+// metrics-extra-labels option. Label names beginning with __ are reserved by
+// Prometheus.
+func (o Options) MetricsExtraLabelSet() (map[string]string, error) {
+	extraLabels := map[string]string{}
+	if o.MetricsExtraLabels == "" {
+		return extraLabels, nil
+	}
+	for _, pair := range strings.Split(o.MetricsExtraLabels, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("metrics-extra-labels \"%s\" must be of the form key=value", pair)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !metricLabelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("metrics-extra-labels \"%s\" is not a valid label name", name)
+		}
+		if !utf8.ValidString(value) {
+			return nil, fmt.Errorf("metrics-extra-labels value for \"%s\" is not valid UTF-8", name)
+		}
+		if _, ok := extraLabels[name]; ok {
+			return nil, fmt.Errorf("metrics-extra-labels \"%s\" is set more than once", name)
+		}
+		extraLabels[name] = value
+	}
+	return extraLabels, nil
+}
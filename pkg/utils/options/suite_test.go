@@ -0,0 +1,388 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"knative.dev/pkg/ptr"
+)
+
+func TestOptions(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Options")
+}
+
+var _ = Describe("Validation", func() {
+	var opts Options
+
+	BeforeEach(func() {
+		opts = Options{
+			ClusterName:                 "test-cluster",
+			ClusterEndpoint:             "https://test-cluster",
+			Namespace:                   "karpenter",
+			MetricsPort:                 8080,
+			HealthProbePort:             8081,
+			WebhookPort:                 8443,
+			KubeClientQPS:               200,
+			KubeClientBurst:             300,
+			AWSNodeNameConvention:       "ip-name",
+			MetricsReconcileConcurrency: 10,
+			MetricsReadTimeout:          30 * time.Second,
+			MetricsWriteTimeout:         30 * time.Second,
+		}
+	})
+
+	It("should succeed with valid options", func() {
+		Expect(opts.Validate()).To(Succeed())
+	})
+
+	Context("Ports", func() {
+		It("should fail when two ports collide", func() {
+			opts.HealthProbePort = opts.MetricsPort
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("metrics-port and health-probe-port must be distinct"))
+		})
+		It("should fail when all ports collide", func() {
+			opts.MetricsPort = opts.WebhookPort
+			opts.HealthProbePort = opts.WebhookPort
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("webhook-port and metrics-port must be distinct"))
+			Expect(err.Error()).To(ContainSubstring("webhook-port and health-probe-port must be distinct"))
+		})
+		It("should warn for privileged ports without failing", func() {
+			opts.MetricsPort = 80
+			opts.HealthProbePort = 443
+			Expect(opts.Validate()).To(Succeed())
+			Expect(opts.Warnings()).To(ConsistOf(
+				ContainSubstring("metrics-port 80 is privileged"),
+				ContainSubstring("health-probe-port 443 is privileged"),
+			))
+		})
+		It("should not warn for unprivileged or unset ports", func() {
+			opts.WebhookPort = 0
+			Expect(opts.Warnings()).To(BeEmpty())
+		})
+		It("should allow unset ports", func() {
+			opts.MetricsPort = 0
+			opts.HealthProbePort = 0
+			Expect(opts.Validate()).To(Succeed())
+		})
+	})
+
+	Context("Endpoints", func() {
+		It("should parse a single endpoint", func() {
+			Expect(opts.Validate()).To(Succeed())
+			endpoints := opts.Endpoints()
+			Expect(endpoints).To(HaveLen(1))
+			Expect(endpoints[0].String()).To(Equal("https://test-cluster"))
+		})
+		It("should parse multiple endpoints", func() {
+			opts.ClusterEndpoint = "https://test-cluster-1, https://test-cluster-2:8443"
+			Expect(opts.Validate()).To(Succeed())
+			endpoints := opts.Endpoints()
+			Expect(endpoints).To(HaveLen(2))
+			Expect(endpoints[0].String()).To(Equal("https://test-cluster-1"))
+			Expect(endpoints[1].String()).To(Equal("https://test-cluster-2:8443"))
+		})
+		It("should fail when any endpoint is invalid", func() {
+			opts.ClusterEndpoint = "https://test-cluster-1,test-cluster-2"
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("\"test-cluster-2\" not a valid CLUSTER_ENDPOINT URL"))
+		})
+	})
+
+	Context("Endpoint Reachability", func() {
+		BeforeEach(func() {
+			opts.ValidateEndpointReachability = true
+		})
+		It("should succeed when the endpoint is reachable", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			defer server.Close()
+			opts.ClusterEndpoint = server.URL
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should fail when the endpoint is unreachable", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			address := listener.Addr().String()
+			Expect(listener.Close()).To(Succeed())
+			opts.ClusterEndpoint = "https://" + address
+			err = opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not reachable"))
+		})
+		It("should succeed when the https endpoint completes a TLS handshake", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			defer server.Close()
+			opts.ClusterEndpoint = server.URL
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should fail when the https endpoint does not serve TLS", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			defer server.Close()
+			opts.ClusterEndpoint = strings.Replace(server.URL, "http://", "https://", 1)
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not reachable"))
+		})
+		It("should succeed when any endpoint is reachable", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			defer server.Close()
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			address := listener.Addr().String()
+			Expect(listener.Close()).To(Succeed())
+			opts.ClusterEndpoint = "https://" + address + "," + server.URL
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should not dial the endpoint when disabled", func() {
+			opts.ValidateEndpointReachability = false
+			opts.ClusterEndpoint = "https://127.0.0.1:1"
+			Expect(opts.Validate()).To(Succeed())
+		})
+	})
+
+	Context("Endpoint DNS", func() {
+		BeforeEach(func() {
+			opts.ValidateEndpointDNS = true
+			lookupHost = func(host string) ([]string, error) {
+				if host == "test-cluster" {
+					return []string{"10.0.0.1"}, nil
+				}
+				return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+			}
+		})
+		AfterEach(func() {
+			lookupHost = net.LookupHost
+		})
+		It("should succeed when the endpoint host resolves", func() {
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should fail when the endpoint host does not resolve", func() {
+			opts.ClusterEndpoint = "https://unresolvable-cluster"
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("host \"unresolvable-cluster\" does not resolve"))
+		})
+		It("should succeed when the lookup fails transiently", func() {
+			lookupHost = func(host string) ([]string, error) {
+				return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+			}
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should not resolve the endpoint host when disabled", func() {
+			opts.ValidateEndpointDNS = false
+			opts.ClusterEndpoint = "https://unresolvable-cluster"
+			Expect(opts.Validate()).To(Succeed())
+		})
+	})
+
+	Context("Pod Metrics Selector", func() {
+		It("should succeed for a valid selector", func() {
+			opts.PodMetricsSelector = "karpenter.sh/managed=true"
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should fail for an invalid selector", func() {
+			opts.PodMetricsSelector = "karpenter.sh/managed in (true"
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+	})
+
+	Context("Metrics Reconcile Concurrency", func() {
+		It("should fail when less than one", func() {
+			opts.MetricsReconcileConcurrency = 0
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+	})
+
+	Context("Metrics Extra Labels", func() {
+		It("should parse key value pairs", func() {
+			opts.MetricsExtraLabels = "cluster=prod, region=us-east-1"
+			Expect(opts.Validate()).To(Succeed())
+			Expect(opts.MetricsExtraLabelSet()).To(Equal(map[string]string{"cluster": "prod", "region": "us-east-1"}))
+		})
+		It("should fail for malformed labels", func() {
+			for _, extraLabels := range []string{"cluster", "cluster=prod,", "1cluster=prod", "__cluster=prod", "clus-ter=prod", "cluster=prod,cluster=dev"} {
+				opts.MetricsExtraLabels = extraLabels
+				Expect(opts.Validate()).ToNot(Succeed(), extraLabels)
+			}
+		})
+	})
+
+	Context("Metrics Path", func() {
+		It("should succeed for an absolute path", func() {
+			opts.MetricsPath = "/karpenter/metrics"
+			Expect(opts.Validate()).To(Succeed())
+		})
+		It("should fail for a relative path", func() {
+			opts.MetricsPath = "karpenter/metrics"
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+	})
+
+	Context("Consolidation Utilization Threshold", func() {
+		It("should succeed between 0 and 1", func() {
+			for _, threshold := range []float64{0, 0.5, 1} {
+				opts.ConsolidationUtilizationThreshold = threshold
+				Expect(opts.Validate()).To(Succeed())
+			}
+		})
+		It("should fail outside of 0 and 1", func() {
+			for _, threshold := range []float64{-0.1, 1.1} {
+				opts.ConsolidationUtilizationThreshold = threshold
+				Expect(opts.Validate()).ToNot(Succeed())
+			}
+		})
+	})
+
+	Context("Reconcile Rate Limiter", func() {
+		It("should fail when the base delay exceeds the max delay", func() {
+			opts.ReconcileBaseDelay = time.Minute
+			opts.ReconcileMaxDelay = time.Second
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+		It("should back off between the configured delays", func() {
+			opts.ReconcileBaseDelay = time.Second
+			opts.ReconcileMaxDelay = 4 * time.Second
+			limiter := opts.ReconcileRateLimiter()
+			Expect(limiter.When("item")).To(Equal(time.Second))
+			Expect(limiter.When("item")).To(Equal(2 * time.Second))
+			Expect(limiter.When("item")).To(Equal(4 * time.Second))
+			Expect(limiter.When("item")).To(Equal(4 * time.Second))
+			limiter.Forget("item")
+			Expect(limiter.When("item")).To(Equal(time.Second))
+		})
+	})
+
+	Context("Kube Client", func() {
+		It("should fail when the burst is less than the qps", func() {
+			opts.KubeClientBurst = opts.KubeClientQPS - 1
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("kube-client-burst 199 cannot be less than kube-client-qps 200"))
+		})
+		It("should warn for a qps above the cap without failing", func() {
+			opts.KubeClientQPS = 1001
+			opts.KubeClientBurst = 1500
+			Expect(opts.Validate()).To(Succeed())
+			Expect(opts.Warnings()).To(ConsistOf(ContainSubstring("kube-client-qps 1001 exceeds 1000")))
+		})
+		It("should not warn for a qps at the cap", func() {
+			opts.KubeClientQPS = 1000
+			opts.KubeClientBurst = 1000
+			Expect(opts.Warnings()).To(BeEmpty())
+		})
+	})
+
+	Context("Resync Period", func() {
+		It("should fail when negative", func() {
+			opts.ResyncPeriod = -time.Minute
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+		It("should use the controller-runtime default when unset", func() {
+			Expect(opts.SyncPeriod()).To(BeNil())
+		})
+		It("should return the sync period for the manager when set", func() {
+			opts.ResyncPeriod = 5 * time.Minute
+			Expect(opts.Validate()).To(Succeed())
+			Expect(opts.SyncPeriod()).To(Equal(ptr.Duration(5 * time.Minute)))
+		})
+	})
+
+	Context("Metrics Provisioner Allowlist", func() {
+		It("should allow all provisioners when empty", func() {
+			Expect(opts.MetricsProvisionerAllowed("default")).To(BeTrue())
+		})
+		It("should only allow listed provisioners", func() {
+			opts.MetricsProvisionerAllowlist = "default, team-a"
+			Expect(opts.MetricsProvisionerAllowed("default")).To(BeTrue())
+			Expect(opts.MetricsProvisionerAllowed("team-a")).To(BeTrue())
+			Expect(opts.MetricsProvisionerAllowed("team-b")).To(BeFalse())
+		})
+	})
+
+	Context("Namespace", func() {
+		var fs *flag.FlagSet
+
+		BeforeEach(func() {
+			fs = flag.NewFlagSet("karpenter", flag.ContinueOnError)
+		})
+		AfterEach(func() {
+			Expect(os.Unsetenv("POD_NAMESPACE")).To(Succeed())
+			Expect(os.Unsetenv("SYSTEM_NAMESPACE")).To(Succeed())
+		})
+		It("should fail when unset", func() {
+			opts.Namespace = ""
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("namespace is required"))
+		})
+		It("should default from the POD_NAMESPACE environment variable", func() {
+			Expect(os.Setenv("POD_NAMESPACE", "karpenter-system")).To(Succeed())
+			parsed := Options{}
+			parsed.AddFlags(fs)
+			Expect(fs.Parse(nil)).To(Succeed())
+			Expect(parsed.Namespace).To(Equal("karpenter-system"))
+		})
+		It("should fall back to the SYSTEM_NAMESPACE environment variable", func() {
+			Expect(os.Setenv("SYSTEM_NAMESPACE", "karpenter")).To(Succeed())
+			parsed := Options{}
+			parsed.AddFlags(fs)
+			Expect(fs.Parse(nil)).To(Succeed())
+			Expect(parsed.Namespace).To(Equal("karpenter"))
+		})
+		It("should prefer POD_NAMESPACE over SYSTEM_NAMESPACE", func() {
+			Expect(os.Setenv("SYSTEM_NAMESPACE", "karpenter")).To(Succeed())
+			Expect(os.Setenv("POD_NAMESPACE", "karpenter-system")).To(Succeed())
+			parsed := Options{}
+			parsed.AddFlags(fs)
+			Expect(fs.Parse(nil)).To(Succeed())
+			Expect(parsed.Namespace).To(Equal("karpenter-system"))
+		})
+		It("should prefer the namespace flag over the environment variable", func() {
+			Expect(os.Setenv("POD_NAMESPACE", "karpenter-system")).To(Succeed())
+			parsed := Options{}
+			parsed.AddFlags(fs)
+			Expect(fs.Parse([]string{"--namespace", "kube-system"})).To(Succeed())
+			Expect(parsed.Namespace).To(Equal("kube-system"))
+		})
+	})
+
+	Context("Metrics Timeouts", func() {
+		It("should fail when the read timeout is not positive", func() {
+			opts.MetricsReadTimeout = 0
+			err := opts.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("metrics-read-timeout and metrics-write-timeout must be positive"))
+		})
+		It("should fail when the write timeout is negative", func() {
+			opts.MetricsWriteTimeout = -time.Second
+			Expect(opts.Validate()).ToNot(Succeed())
+		})
+	})
+})
@@ -15,6 +15,7 @@ limitations under the License.
 package resources
 
 import (
+	"github.com/aws/karpenter/pkg/utils/pod"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -48,6 +49,67 @@ func LimitsForPods(pods ...*v1.Pod) v1.ResourceList {
 	return Merge(resources...)
 }
 
+// PodResources returns the effective requests and limits of a pod. Each init
+// container runs alone, so a resource's effective value is the greater of the sum
+// across containers and the largest init container. Pod overhead is added to
+// requests, and to limits only where a limit is set. Terminal pods no longer
+// consume resources, so empty lists are returned for them.
+func PodResources(p *v1.Pod) (requests v1.ResourceList, limits v1.ResourceList) {
+	requests, limits = v1.ResourceList{}, v1.ResourceList{}
+	if pod.IsTerminal(p) {
+		return requests, limits
+	}
+	for _, container := range p.Spec.Containers {
+		requests = Merge(requests, container.Resources.Requests)
+		limits = Merge(limits, container.Resources.Limits)
+	}
+	for _, container := range p.Spec.InitContainers {
+		requests = MaxResources(requests, container.Resources.Requests)
+		limits = MaxResources(limits, container.Resources.Limits)
+	}
+	for resourceName, overhead := range p.Spec.Overhead {
+		requests = Merge(requests, v1.ResourceList{resourceName: overhead})
+		if limit, ok := limits[resourceName]; ok && !limit.IsZero() {
+			limits = Merge(limits, v1.ResourceList{resourceName: overhead})
+		}
+	}
+	return requests, limits
+}
+
+// FittingResources returns the node's allocatable resources less the requests
+// of the pods, which is negative for resources the pods overflow. Each
+// non-terminal pod also requests one of the node's allocatable pods.
+func FittingResources(node *v1.Node, pods []*v1.Pod) v1.ResourceList {
+	remaining := v1.ResourceList{}
+	for resourceName, quantity := range node.Status.Allocatable {
+		remaining[resourceName] = quantity.DeepCopy()
+	}
+	for _, p := range pods {
+		if pod.IsTerminal(p) {
+			continue
+		}
+		requests, _ := PodResources(p)
+		requests[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+		for resourceName, quantity := range requests {
+			current := remaining[resourceName]
+			current.Sub(quantity)
+			remaining[resourceName] = current
+		}
+	}
+	return remaining
+}
+
+// Fits returns true if the pods' requests fit within the node's allocatable
+// resources.
+func Fits(node *v1.Node, pods []*v1.Pod) bool {
+	for _, quantity := range FittingResources(node, pods) {
+		if quantity.Sign() < 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // GPULimitsFor returns a resource list of GPU limits from a pod
 // GPUs must be specified in the Limits section of the pod resources per
 //   https://kubernetes.io/docs/tasks/manage-gpus/scheduling-gpus/
@@ -74,6 +136,19 @@ func Merge(resources ...v1.ResourceList) v1.ResourceList {
 	return result
 }
 
+// MaxResources returns the per resource maximum of the variadic into a single v1.ResourceList
+func MaxResources(resources ...v1.ResourceList) v1.ResourceList {
+	result := v1.ResourceList{}
+	for _, resourceList := range resources {
+		for resourceName, quantity := range resourceList {
+			if current, ok := result[resourceName]; !ok || quantity.Cmp(current) > 0 {
+				result[resourceName] = quantity
+			}
+		}
+	}
+	return result
+}
+
 // Quantity parses the string value into a *Quantity
 func Quantity(value string) *resource.Quantity {
 	r := resource.MustParse(value)
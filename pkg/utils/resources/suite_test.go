@@ -0,0 +1,162 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestResources(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Resources")
+}
+
+var _ = Describe("PodResources", func() {
+	It("should sum container requests and limits", func() {
+		requests, limits := PodResources(&v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{
+			{Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+				Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+			}},
+			{Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+			}},
+		}}})
+		ExpectResources(requests, v1.ResourceList{v1.ResourceCPU: resource.MustParse("1500m"), v1.ResourceMemory: resource.MustParse("1Gi")})
+		ExpectResources(limits, v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")})
+	})
+	It("should use the largest init container when it exceeds the containers", func() {
+		requests, _ := PodResources(&v1.Pod{Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}}},
+				{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("3")}}},
+			},
+			Containers: []v1.Container{
+				{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")}}},
+			},
+		}})
+		ExpectResources(requests, v1.ResourceList{v1.ResourceCPU: resource.MustParse("3"), v1.ResourceMemory: resource.MustParse("1Gi")})
+	})
+	It("should count init containers of pods without containers", func() {
+		requests, limits := PodResources(&v1.Pod{Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("512Mi")},
+					Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				}},
+			},
+		}})
+		ExpectResources(requests, v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("512Mi")})
+		ExpectResources(limits, v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")})
+	})
+	It("should add overhead to requests and to non-zero limits only", func() {
+		requests, limits := PodResources(&v1.Pod{Spec: v1.PodSpec{
+			Overhead: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("128Mi")},
+			Containers: []v1.Container{
+				{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+					Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				}},
+			},
+		}})
+		ExpectResources(requests, v1.ResourceList{v1.ResourceCPU: resource.MustParse("1100m"), v1.ResourceMemory: resource.MustParse("1152Mi")})
+		ExpectResources(limits, v1.ResourceList{v1.ResourceCPU: resource.MustParse("2100m")})
+	})
+	It("should return empty resources for terminal pods", func() {
+		for _, phase := range []v1.PodPhase{v1.PodSucceeded, v1.PodFailed} {
+			requests, limits := PodResources(&v1.Pod{
+				Spec: v1.PodSpec{Containers: []v1.Container{
+					{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}}},
+				}},
+				Status: v1.PodStatus{Phase: phase},
+			})
+			Expect(requests).To(BeEmpty())
+			Expect(limits).To(BeEmpty())
+		}
+	})
+})
+
+var _ = Describe("Fits", func() {
+	var node *v1.Node
+	podRequesting := func(cpu string, memory string) *v1.Pod {
+		return &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)},
+		}}}}}
+	}
+
+	BeforeEach(func() {
+		node = &v1.Node{Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+			v1.ResourcePods:   resource.MustParse("3"),
+		}}}
+	})
+
+	It("should fit pods that exactly fill the node", func() {
+		pods := []*v1.Pod{podRequesting("1", "2Gi"), podRequesting("1", "2Gi")}
+		Expect(Fits(node, pods)).To(BeTrue())
+		ExpectResources(FittingResources(node, pods), v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("0"),
+			v1.ResourceMemory: resource.MustParse("0"),
+			v1.ResourcePods:   resource.MustParse("1"),
+		})
+	})
+	It("should fit pods that underfill the node", func() {
+		pods := []*v1.Pod{podRequesting("500m", "1Gi")}
+		Expect(Fits(node, pods)).To(BeTrue())
+		ExpectResources(FittingResources(node, pods), v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("1500m"),
+			v1.ResourceMemory: resource.MustParse("3Gi"),
+			v1.ResourcePods:   resource.MustParse("2"),
+		})
+	})
+	It("should not fit pods that overflow a resource", func() {
+		pods := []*v1.Pod{podRequesting("1", "2Gi"), podRequesting("1500m", "1Gi")}
+		Expect(Fits(node, pods)).To(BeFalse())
+		ExpectResources(FittingResources(node, pods), v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("-500m"),
+			v1.ResourceMemory: resource.MustParse("1Gi"),
+			v1.ResourcePods:   resource.MustParse("1"),
+		})
+	})
+	It("should not fit more pods than the node allows", func() {
+		pods := []*v1.Pod{podRequesting("100m", "1Mi"), podRequesting("100m", "1Mi"), podRequesting("100m", "1Mi"), podRequesting("100m", "1Mi")}
+		Expect(Fits(node, pods)).To(BeFalse())
+	})
+	It("should not fit pods requesting resources the node lacks", func() {
+		pod := podRequesting("100m", "1Mi")
+		pod.Spec.Containers[0].Resources.Requests[NvidiaGPU] = resource.MustParse("1")
+		Expect(Fits(node, []*v1.Pod{pod})).To(BeFalse())
+	})
+	It("should ignore terminal pods", func() {
+		pod := podRequesting("4", "8Gi")
+		pod.Status.Phase = v1.PodSucceeded
+		Expect(Fits(node, []*v1.Pod{pod})).To(BeTrue())
+	})
+})
+
+func ExpectResources(actual v1.ResourceList, expected v1.ResourceList) {
+	Expect(actual).To(HaveLen(len(expected)))
+	for resourceName, quantity := range expected {
+		Expect(actual).To(HaveKey(resourceName))
+		actualQuantity := actual[resourceName]
+		Expect(actualQuantity.Cmp(quantity)).To(BeZero(), "%s: expected %s, got %s", resourceName, quantity.String(), actualQuantity.String())
+	}
+}